@@ -1,28 +1,44 @@
 package api
 
 import (
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mikeudacha/paybuy/config"
+	"github.com/mikeudacha/paybuy/db"
+	"github.com/mikeudacha/paybuy/money"
+	"github.com/mikeudacha/paybuy/services/address"
 	"github.com/mikeudacha/paybuy/services/auth"
 	"github.com/mikeudacha/paybuy/services/cart"
+	"github.com/mikeudacha/paybuy/services/exchange"
+	"github.com/mikeudacha/paybuy/services/idempotency"
+	"github.com/mikeudacha/paybuy/services/inventory"
+	"github.com/mikeudacha/paybuy/services/mail"
 	"github.com/mikeudacha/paybuy/services/order"
+	"github.com/mikeudacha/paybuy/services/payment"
 	"github.com/mikeudacha/paybuy/services/product"
+	"github.com/mikeudacha/paybuy/services/promotion"
+	"github.com/mikeudacha/paybuy/services/shipping"
+	"github.com/mikeudacha/paybuy/services/tax"
 	"github.com/mikeudacha/paybuy/services/user"
 )
 
 type APIServer struct {
 	addr string
 	db   *pgxpool.Pool
+	cfg  *config.Config
 }
 
-func NewAPIServer(addr string, db *pgxpool.Pool) *APIServer {
+func NewAPIServer(addr string, db *pgxpool.Pool, cfg *config.Config) *APIServer {
 	return &APIServer{
 		addr: addr,
 		db:   db,
+		cfg:  cfg,
 	}
 }
 
@@ -33,16 +49,92 @@ func (s *APIServer) Run() error {
 
 	blacklistStore.CleanupExpiredTokensPeriodically(1 * time.Hour)
 
+	refreshTokenStore := auth.NewRefreshTokenStore(s.db)
+
+	refreshTokenStore.CleanupExpiredTokensPeriodically(1 * time.Hour)
+
+	idempotencyStore := idempotency.NewStore(s.db)
+
+	idempotencyStore.CleanupExpiredKeysPeriodically(1 * time.Hour)
+
+	mailer, err := newMailer(s.cfg)
+	if err != nil {
+		return err
+	}
+
 	userStore := user.NewStore(s.db)
-	userHandler := user.NewHandler(userStore, blacklistStore)
+	passwordResetStore := user.NewPasswordResetStore(s.db)
+	mfaStore := user.NewMFAStore(s.db)
+
+	passwordResetStore.CleanupExpiredTokensPeriodically(1 * time.Hour)
+
+	userHandler := user.NewHandler(userStore, passwordResetStore, mfaStore, mailer, blacklistStore, refreshTokenStore)
 	userHandler.RegisterRoutes(router)
 
-	productStore := product.NewStore(s.db)
-	productHandler := product.NewHandler(productStore, userStore, blacklistStore)
+	reservationTTL, _ := strconv.Atoi(s.cfg.ReservationTTLInSeconds)
+	inventoryStore := inventory.NewStore(s.db, time.Duration(reservationTTL)*time.Second)
+
+	productStore := product.NewStore(s.db, inventoryStore)
+	productHandler := product.NewHandler(productStore, inventoryStore, userStore, blacklistStore, idempotencyStore)
+
+	couponStore := promotion.NewStore(s.db)
+	orderStore := order.NewStore(s.db, inventoryStore, couponStore)
+
+	inventoryStore.ReleaseExpiredReservationsPeriodically(orderStore, 1*time.Minute)
+
+	orderHandler := order.NewHandler(orderStore, userStore, blacklistStore)
+	orderHandler.RegisterRoutes(router)
+
+	promotionHandler := promotion.NewHandler(couponStore, userStore, blacklistStore)
+	promotionHandler.RegisterRoutes(router)
+
+	taxStore := tax.NewStore(s.db)
+	taxHandler := tax.NewHandler(taxStore, userStore, blacklistStore)
+	taxHandler.RegisterRoutes(router)
+
+	addressStore := address.NewStore(s.db)
+	addressHandler := address.NewHandler(addressStore, userStore, blacklistStore)
+	addressHandler.RegisterRoutes(router)
 
-	orderStore := order.NewStore(s.db)
+	txManager := db.NewTxManager(s.db)
 
-	cartHandler := cart.NewHandler(productStore, orderStore, userStore, blacklistStore)
+	gateway, err := newPaymentGateway(s.cfg.PaymentProvider)
+	if err != nil {
+		return err
+	}
+	paymentStore := payment.NewStore(s.db)
+	paymentService := payment.NewService(gateway, paymentStore, orderStore, txManager)
+	paymentHandler := payment.NewHandler(paymentService, s.cfg.PaymentWebhookSecret)
+	paymentHandler.RegisterRoutes(router)
+
+	rates, err := newRateProvider(s.cfg.ExchangeRatesFile)
+	if err != nil {
+		return err
+	}
+
+	shippingStore := shipping.NewStore(s.db)
+	shippingCalculator := shipping.NewTableCalculator(shippingStore, rates)
+	shippingHandler := shipping.NewHandler(shippingStore, shippingCalculator, userStore, blacklistStore)
+	shippingHandler.RegisterRoutes(router)
+
+	cartStore := cart.NewStore(s.db)
+
+	cartHandler := cart.NewHandler(
+		cartStore,
+		productStore,
+		orderStore,
+		couponStore,
+		addressStore,
+		inventoryStore,
+		userStore,
+		blacklistStore,
+		txManager,
+		idempotencyStore,
+		paymentService,
+		rates,
+		tax.NewRuleTableCalculator(taxStore),
+		shippingCalculator,
+	)
 	cartHandler.RegisterRoutes(router)
 
 	productHandler.RegisterRoutes(router)
@@ -51,3 +143,38 @@ func (s *APIServer) Run() error {
 
 	return http.ListenAndServe(s.addr, router)
 }
+
+func newPaymentGateway(provider string) (payment.PaymentGateway, error) {
+	switch provider {
+	case "", "fake":
+		return payment.NewFakeGateway(), nil
+	default:
+		return nil, fmt.Errorf("unsupported payment provider: %s", provider)
+	}
+}
+
+func newMailer(cfg *config.Config) (mail.Mailer, error) {
+	switch cfg.MailProvider {
+	case "", "memory":
+		return mail.NewMemoryMailer(), nil
+	case "file":
+		if cfg.MailFile == "" {
+			return nil, fmt.Errorf("MAIL_FILE is required for the file mail provider")
+		}
+		return mail.NewFileMailer(cfg.MailFile, cfg.MailFrom), nil
+	case "smtp":
+		if cfg.SMTPHost == "" || cfg.SMTPPort == "" || cfg.MailFrom == "" {
+			return nil, fmt.Errorf("SMTP_HOST, SMTP_PORT and MAIL_FROM are required for the smtp mail provider")
+		}
+		return mail.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom), nil
+	default:
+		return nil, fmt.Errorf("unsupported mail provider: %s", cfg.MailProvider)
+	}
+}
+
+func newRateProvider(path string) (exchange.RateProvider, error) {
+	if path == "" {
+		return exchange.NewStaticRateProvider(money.DefaultCurrency, nil), nil
+	}
+	return exchange.NewStaticRateProviderFromFile(path)
+}
@@ -21,7 +21,7 @@ func main() {
 		log.Fatal(err)
 	}
 	initStorage(pool)
-	server := api.NewAPIServer(cfg.Host, pool)
+	server := api.NewAPIServer(cfg.Host, pool, cfg)
 	if err := server.Run(); err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_orders_user_id_created_at;
+DROP INDEX IF EXISTS idx_order_items_order_id;
+
+ALTER TABLE order_items
+    DROP COLUMN IF EXISTS created_at,
+    DROP COLUMN IF EXISTS product_image,
+    DROP COLUMN IF EXISTS product_name;
@@ -0,0 +1,9 @@
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS exchange_rate,
+    DROP COLUMN IF EXISTS currency;
+
+ALTER TABLE cart_items DROP COLUMN IF EXISTS currency;
+
+DROP TABLE IF EXISTS product_prices;
+
+ALTER TABLE products DROP COLUMN IF EXISTS currency;
@@ -0,0 +1,50 @@
+CREATE TABLE IF NOT EXISTS coupons (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(64) NOT NULL UNIQUE,
+    type TEXT NOT NULL CHECK (type IN ('percentage', 'fixed_amount', 'free_shipping', 'buy_x_get_y')),
+    percent INTEGER CHECK (percent BETWEEN 1 AND 100),
+    amount NUMERIC(10, 2) CHECK (amount > 0),
+    currency CHAR(3) NOT NULL DEFAULT 'USD',
+    product_id INTEGER REFERENCES products(id) ON DELETE CASCADE,
+    buy_quantity INTEGER CHECK (buy_quantity > 0),
+    get_quantity INTEGER CHECK (get_quantity > 0),
+    min_order_value NUMERIC(10, 2),
+    starts_at TIMESTAMP,
+    ends_at TIMESTAMP,
+    max_uses INTEGER CHECK (max_uses > 0),
+    max_uses_per_user INTEGER CHECK (max_uses_per_user > 0),
+    used_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS coupon_redemptions (
+    id SERIAL PRIMARY KEY,
+    coupon_id INTEGER NOT NULL REFERENCES coupons(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_coupon_redemptions_coupon_user ON coupon_redemptions(coupon_id, user_id);
+
+CREATE TABLE IF NOT EXISTS order_discounts (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    coupon_id INTEGER REFERENCES coupons(id) ON DELETE SET NULL,
+    coupon_code VARCHAR(64) NOT NULL,
+    type TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    amount NUMERIC(10, 2) NOT NULL,
+    free_shipping BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_order_discounts_order_id ON order_discounts(order_id);
+
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS subtotal NUMERIC(10, 2),
+    ADD COLUMN IF NOT EXISTS discount_total NUMERIC(10, 2) NOT NULL DEFAULT 0;
+
+UPDATE orders SET subtotal = total WHERE subtotal IS NULL;
+
+ALTER TABLE orders ALTER COLUMN subtotal SET NOT NULL;
@@ -0,0 +1,14 @@
+ALTER TABLE order_items
+    DROP COLUMN IF EXISTS tax_amount,
+    DROP COLUMN IF EXISTS tax_rate,
+    DROP COLUMN IF EXISTS tax_category;
+
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS tax_region,
+    DROP COLUMN IF EXISTS tax_country,
+    DROP COLUMN IF EXISTS tax_total;
+
+ALTER TABLE products
+    DROP COLUMN IF EXISTS tax_category;
+
+DROP TABLE IF EXISTS tax_rules;
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS tax_rules (
+    id SERIAL PRIMARY KEY,
+    country CHAR(2) NOT NULL,
+    region VARCHAR(64) NOT NULL DEFAULT '',
+    tax_category VARCHAR(64) NOT NULL DEFAULT 'standard',
+    rate NUMERIC(7, 6) NOT NULL CHECK (rate >= 0),
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (country, region, tax_category)
+);
+
+ALTER TABLE products
+    ADD COLUMN IF NOT EXISTS tax_category VARCHAR(64) NOT NULL DEFAULT 'standard';
+
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS tax_total NUMERIC(10, 2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS tax_country CHAR(2) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS tax_region VARCHAR(64) NOT NULL DEFAULT '';
+
+ALTER TABLE order_items
+    ADD COLUMN IF NOT EXISTS tax_category VARCHAR(64) NOT NULL DEFAULT 'standard',
+    ADD COLUMN IF NOT EXISTS tax_rate NUMERIC(7, 6) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS tax_amount NUMERIC(10, 2) NOT NULL DEFAULT 0;
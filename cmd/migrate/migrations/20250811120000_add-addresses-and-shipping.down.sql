@@ -0,0 +1,11 @@
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS shipping_address,
+    DROP COLUMN IF EXISTS shipping_method,
+    DROP COLUMN IF EXISTS shipping_total;
+
+ALTER TABLE products
+    DROP COLUMN IF EXISTS weight_grams;
+
+DROP TABLE IF EXISTS shipping_rates;
+DROP TABLE IF EXISTS shipping_zones;
+DROP TABLE IF EXISTS addresses;
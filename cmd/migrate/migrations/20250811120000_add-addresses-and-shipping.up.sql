@@ -0,0 +1,52 @@
+CREATE TABLE IF NOT EXISTS addresses (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    label VARCHAR(64) NOT NULL DEFAULT '',
+    recipient VARCHAR(255) NOT NULL,
+    line1 VARCHAR(255) NOT NULL,
+    line2 VARCHAR(255) NOT NULL DEFAULT '',
+    city VARCHAR(128) NOT NULL,
+    region VARCHAR(64) NOT NULL DEFAULT '',
+    postal_code VARCHAR(32) NOT NULL,
+    country CHAR(2) NOT NULL,
+    phone VARCHAR(32) NOT NULL DEFAULT '',
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_addresses_user_id ON addresses(user_id);
+CREATE UNIQUE INDEX idx_addresses_user_default ON addresses(user_id) WHERE is_default;
+
+-- A zone with no countries is the fallback for every country not listed in
+-- another zone.
+CREATE TABLE IF NOT EXISTS shipping_zones (
+    code VARCHAR(32) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    countries CHAR(2)[] NOT NULL DEFAULT '{}',
+    free_shipping_threshold NUMERIC(10, 2),
+    currency CHAR(3) NOT NULL DEFAULT 'USD',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Each row prices a method for parcels up to max_weight_grams; NULL means no
+-- upper limit.
+CREATE TABLE IF NOT EXISTS shipping_rates (
+    id SERIAL PRIMARY KEY,
+    zone VARCHAR(32) NOT NULL REFERENCES shipping_zones(code) ON DELETE CASCADE,
+    method VARCHAR(64) NOT NULL,
+    max_weight_grams INTEGER CHECK (max_weight_grams > 0),
+    price NUMERIC(10, 2) NOT NULL CHECK (price >= 0),
+    currency CHAR(3) NOT NULL DEFAULT 'USD',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_shipping_rates_zone ON shipping_rates(zone, method);
+
+ALTER TABLE products
+    ADD COLUMN IF NOT EXISTS weight_grams INTEGER NOT NULL DEFAULT 0 CHECK (weight_grams >= 0);
+
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS shipping_total NUMERIC(10, 2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS shipping_method VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS shipping_address JSONB;
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS stock_reservations (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'converted', 'released')),
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_stock_reservations_order_id ON stock_reservations(order_id);
+CREATE INDEX idx_stock_reservations_active_product ON stock_reservations(product_id) WHERE status = 'active';
+CREATE INDEX idx_stock_reservations_active_expiry ON stock_reservations(expires_at) WHERE status = 'active';
+
+-- Pending orders placed before reservations existed already had their stock
+-- deducted. Record that as converted reservations so cancelling them still
+-- puts the stock back.
+INSERT INTO stock_reservations (order_id, product_id, quantity, status, expires_at)
+SELECT oi.order_id, oi.product_id, SUM(oi.quantity), 'converted', CURRENT_TIMESTAMP
+FROM order_items oi
+JOIN orders o ON o.id = oi.order_id
+WHERE o.status = 'pending'
+GROUP BY oi.order_id, oi.product_id;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS stock_movements (
+    id BIGSERIAL PRIMARY KEY,
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE RESTRICT,
+    delta INTEGER NOT NULL CHECK (delta <> 0),
+    quantity_after INTEGER NOT NULL,
+    reason TEXT NOT NULL CHECK (reason IN ('initial', 'checkout', 'cancellation', 'adjustment', 'import', 'return')),
+    actor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    reference VARCHAR(255) NOT NULL DEFAULT '',
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_stock_movements_product_id ON stock_movements(product_id, id);
+
+CREATE OR REPLACE FUNCTION reject_stock_movement_change() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'stock_movements is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER stock_movements_append_only
+    BEFORE UPDATE OR DELETE ON stock_movements
+    FOR EACH ROW EXECUTE FUNCTION reject_stock_movement_change();
+
+-- Open the ledger of every existing product with its current stock.
+INSERT INTO stock_movements (product_id, delta, quantity_after, reason, note)
+SELECT id, quantity, quantity, 'initial', 'opening balance'
+FROM products
+WHERE quantity <> 0;
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/mikeudacha/paybuy/services/payment"
+)
+
+// paysim signs payment webhook events with the shared secret and posts them
+// to the API, so the webhook flow can be exercised without a real provider.
+//
+//	go run cmd/paysim/main.go -type payment.captured -payment fake_pay_1
+//	go run cmd/paysim/main.go -file cmd/paysim/events/captured.json -repeat 2
+func main() {
+	url := flag.String("url", "http://localhost:8080/webhooks/payments", "webhook endpoint")
+	secret := flag.String("secret", os.Getenv("PAYMENT_WEBHOOK_SECRET"), "webhook signing secret")
+	file := flag.String("file", "", "JSON event to replay instead of building one from flags")
+	eventType := flag.String("type", payment.EventPaymentCaptured, "event type")
+	eventID := flag.String("id", "", "provider event ID (random when empty)")
+	paymentID := flag.String("payment", "", "provider payment ID")
+	reason := flag.String("reason", "", "failure reason for payment.failed events")
+	repeat := flag.Int("repeat", 1, "number of times to send the event")
+	flag.Parse()
+
+	if *secret == "" {
+		log.Fatal("missing signing secret: set -secret or PAYMENT_WEBHOOK_SECRET")
+	}
+
+	body, err := buildEvent(*file, *eventType, *eventID, *paymentID, *reason)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for i := 0; i < *repeat; i++ {
+		if err := send(*url, *secret, body); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func buildEvent(file, eventType, eventID, paymentID, reason string) ([]byte, error) {
+	if file != "" {
+		body, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read event file: %w", err)
+		}
+		if _, err := payment.ParseWebhookEvent(body); err != nil {
+			return nil, err
+		}
+		return body, nil
+	}
+
+	if paymentID == "" {
+		return nil, fmt.Errorf("missing -payment")
+	}
+	if eventID == "" {
+		eventID = fmt.Sprintf("evt_sim_%d", time.Now().UnixNano())
+	}
+
+	return json.Marshal(payment.WebhookEvent{
+		ID:   eventID,
+		Type: eventType,
+		Data: payment.WebhookEventData{
+			ProviderPaymentID: paymentID,
+			Reason:            reason,
+		},
+	})
+}
+
+func send(url, secret string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(payment.SignatureHeader, payment.SignWebhookPayload(secret, time.Now().Unix(), body))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	log.Printf("%s -> %s %s", body, resp.Status, bytes.TrimSpace(respBody))
+
+	return nil
+}
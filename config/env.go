@@ -21,6 +21,21 @@ type Config struct {
 	JWTRefreshExpirationInSeconds string
 	Environment                   string
 	CookieDomain                  string
+	PaymentProvider               string
+	PaymentWebhookSecret          string
+	ExchangeRatesFile             string
+	ReservationTTLInSeconds       string
+	BootstrapAdminEmail           string
+	MailProvider                  string
+	MailFrom                      string
+	MailFile                      string
+	SMTPHost                      string
+	SMTPPort                      string
+	SMTPUsername                  string
+	SMTPPassword                  string
+	EmailVerificationSecret       string
+	RequireVerifiedEmailCheckout  string
+	PasswordResetURL              string
 }
 
 func LoadConfig() *Config {
@@ -42,5 +57,20 @@ func LoadConfig() *Config {
 		JWTRefreshExpirationInSeconds: os.Getenv("JWTRefreshExpirationInSeconds"),
 		Environment:                   os.Getenv("ENVIRONMENT"),
 		CookieDomain:                  os.Getenv("COOKIE_DOMAIN"),
+		PaymentProvider:               os.Getenv("PAYMENT_PROVIDER"),
+		PaymentWebhookSecret:          os.Getenv("PAYMENT_WEBHOOK_SECRET"),
+		ExchangeRatesFile:             os.Getenv("EXCHANGE_RATES_FILE"),
+		ReservationTTLInSeconds:       os.Getenv("RESERVATION_TTL_SECONDS"),
+		BootstrapAdminEmail:           os.Getenv("BOOTSTRAP_ADMIN_EMAIL"),
+		MailProvider:                  os.Getenv("MAIL_PROVIDER"),
+		MailFrom:                      os.Getenv("MAIL_FROM"),
+		MailFile:                      os.Getenv("MAIL_FILE"),
+		SMTPHost:                      os.Getenv("SMTP_HOST"),
+		SMTPPort:                      os.Getenv("SMTP_PORT"),
+		SMTPUsername:                  os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:                  os.Getenv("SMTP_PASSWORD"),
+		EmailVerificationSecret:       os.Getenv("EMAIL_VERIFICATION_SECRET"),
+		RequireVerifiedEmailCheckout:  os.Getenv("REQUIRE_VERIFIED_EMAIL_FOR_CHECKOUT"),
+		PasswordResetURL:              os.Getenv("PASSWORD_RESET_URL"),
 	}
 }
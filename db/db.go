@@ -2,10 +2,21 @@ package db
 
 import (
 	"context"
-	"github.com/jackc/pgx/v5/pgxpool"
 	"log"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Querier is satisfied by both *pgxpool.Pool and pgx.Tx, so store helpers
+// can run the same statement inside or outside a transaction.
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 func NewStorage(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
 	db, err := pgxpool.New(ctx, dsn)
 	if err != nil {
@@ -13,3 +24,29 @@ func NewStorage(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
 	}
 	return db, nil
 }
+
+type TxManager struct {
+	pool *pgxpool.Pool
+}
+
+func NewTxManager(pool *pgxpool.Pool) *TxManager {
+	return &TxManager{pool: pool}
+}
+
+// WithTx runs fn inside a single transaction. The transaction is committed
+// when fn returns nil and rolled back otherwise.
+func (m *TxManager) WithTx(fn func(tx pgx.Tx) error) error {
+	ctx := context.Background()
+
+	tx, err := m.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -1,6 +1,11 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mikeudacha/paybuy/money"
+)
 
 type RegisterUserPayload struct {
 	FirstName string `json:"firstName" validate:"required"`
@@ -10,63 +15,287 @@ type RegisterUserPayload struct {
 }
 
 type User struct {
-	ID        int       `json:"id"`
-	FirstName string    `json:"firstName"`
-	LastName  string    `json:"lastName"`
-	Email     string    `json:"email"`
-	Password  string    `json:"-"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID              int        `json:"id"`
+	FirstName       string     `json:"firstName"`
+	LastName        string     `json:"lastName"`
+	Email           string     `json:"email"`
+	Password        string     `json:"-"`
+	Roles           []string   `json:"roles,omitempty"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt"`
+	TokenVersion    int        `json:"-"`
+	CreatedAt       time.Time  `json:"createdAt"`
 }
 
 type Order struct {
-	ID        int       `json:"id"`
-	UserID    int       `json:"userID"`
-	Total     float64   `json:"total"`
-	Status    string    `json:"status"`
-	Address   string    `json:"address"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID              int              `json:"id"`
+	UserID          int              `json:"userID"`
+	Subtotal        money.Money      `json:"subtotal"`
+	DiscountTotal   money.Money      `json:"discountTotal"`
+	TaxTotal        money.Money      `json:"taxTotal"`
+	ShippingTotal   money.Money      `json:"shippingTotal"`
+	Total           money.Money      `json:"total"`
+	TaxCountry      string           `json:"taxCountry"`
+	TaxRegion       string           `json:"taxRegion"`
+	ExchangeRate    string           `json:"exchangeRate"`
+	Status          string           `json:"status"`
+	Address         string           `json:"address"`
+	ShippingAddress *ShippingAddress `json:"shippingAddress"`
+	ShippingMethod  string           `json:"shippingMethod"`
+	CreatedAt       time.Time        `json:"createdAt"`
 }
 
 type UserStore interface {
 	GetUserByEmail(email string) (*User, error)
 	GetUserByID(id int) (*User, error)
 	CreateUser(User) error
+	UpdateUser(User) error
+	UpdatePassword(userID int, hashedPassword string) error
+	MarkEmailVerified(userID int, email string) (bool, error)
+	ClaimVerificationEmail(userID int, interval time.Duration) (bool, error)
+	GetUserRoles(userID int) ([]string, error)
+	GrantRole(userID int, role string, grantedBy *int) error
+	RevokeRole(userID int, role string) (bool, error)
+	GrantBootstrapAdmin(userID int) (bool, error)
+}
+
+type PasswordResetStore interface {
+	CreatePasswordResetToken(userID int, tokenHash string, expiresAt time.Time) error
+	ResetPassword(tokenHash, hashedPassword string) (bool, error)
+}
+
+type MFAStore interface {
+	GetTOTP(userID int) (*UserTOTP, error)
+	SetPendingTOTP(userID int, secret string) (bool, error)
+	EnableTOTP(userID int, step int64, recoveryCodeHashes []string) (bool, error)
+	UseTOTPStep(userID int, step int64) (bool, error)
+	UseRecoveryCode(userID int, codeHash string) (bool, error)
+	DisableTOTP(userID int) error
 }
 
 type ProductStore interface {
 	GetProductByID(id int) (*Product, error)
 	GetProductsByID(ids []int) ([]Product, error)
-	GetProducts() ([]*Product, error)
-	CreateProduct(product CreateProductPayload) error
+	// GetProducts returns one page of products matching filter, the cursor of
+	// the next page (empty on the last page) and the total number of matches.
+	GetProducts(filter ProductFilter) ([]*Product, string, int, error)
+	SearchProducts(filter ProductSearchFilter) ([]ProductSearchResult, string, int, error)
+	CreateProduct(product CreateProductPayload, actorID int) error
 	UpdateProduct(Product) error
+	DeleteProduct(id int) error
+	GetProductsByIDForUpdate(tx pgx.Tx, ids []int) ([]Product, error)
+	UpdateProductTx(tx pgx.Tx, product Product) error
+	SetProductPrices(productID int, prices []money.Money) error
 }
 
 type OrderStore interface {
 	CreateOrder(Order) (int, error)
 	CreateOrderItem(OrderItem) error
+	CreateOrderTx(tx pgx.Tx, order Order) (int, error)
+	CreateOrderItemTx(tx pgx.Tx, orderItem OrderItem) error
+	GetOrdersByUserID(userID int, filter OrderFilter) ([]Order, int, error)
+	GetOrderByID(id int) (*Order, error)
+	GetOrderItems(orderID int) ([]OrderItem, error)
+	TransitionStatus(orderID int, to string, changedBy *int, note string) (*Order, error)
+	TransitionStatusTx(tx pgx.Tx, orderID int, to string, changedBy *int, note string) (*Order, error)
+	GetStatusHistory(orderID int) ([]OrderStatusChange, error)
+	CreateOrderDiscountTx(tx pgx.Tx, discount OrderDiscount) error
+	GetOrderDiscounts(orderID int) ([]OrderDiscount, error)
+}
+
+type CouponStore interface {
+	CreateCoupon(Coupon) (int, error)
+	GetCoupons() ([]Coupon, error)
+	GetCouponByCodeForUpdate(tx pgx.Tx, code string) (*Coupon, error)
+	CountUserRedemptionsTx(tx pgx.Tx, couponID, userID int) (int, error)
+	RedeemCouponTx(tx pgx.Tx, couponID, userID, orderID int) error
+	ReleaseRedemptionsTx(tx pgx.Tx, orderID int) error
+}
+
+type TaxRuleStore interface {
+	CreateTaxRule(TaxRule) (int, error)
+	GetTaxRules() ([]TaxRule, error)
+	// GetTaxRulesForCountry returns every rule for country, across all of
+	// its regions and categories.
+	GetTaxRulesForCountry(country string) ([]TaxRule, error)
+}
+
+// InventoryStore manages stock reservations. Reserved units stay in
+// products.quantity until the order is paid, so available stock is the
+// on-hand quantity minus active reservations.
+type InventoryStore interface {
+	// GetReservedQuantitiesTx returns the actively reserved units per product.
+	GetReservedQuantitiesTx(tx pgx.Tx, productIDs []int) (map[int]int, error)
+	ReserveTx(tx pgx.Tx, orderID int, items []CartCheckoutItem) error
+	// ConvertReservationsTx deducts the order's active reservations from
+	// stock.
+	ConvertReservationsTx(tx pgx.Tx, orderID int, actorID *int) error
+	// ReleaseReservationsTx frees the order's active reservations and puts
+	// converted ones back into stock.
+	ReleaseReservationsTx(tx pgx.Tx, orderID int, actorID *int) error
+
+	// MoveStockTx changes a product's on-hand quantity by movement.Delta and
+	// appends the movement to the stock ledger.
+	MoveStockTx(tx pgx.Tx, movement StockMovement) (*StockMovement, error)
+	MoveStock(movement StockMovement) (*StockMovement, error)
+	GetStockMovements(productID int) ([]StockMovement, error)
+	// GetLedgerQuantity returns the stock the ledger accounts for, which
+	// should always equal products.quantity.
+	GetLedgerQuantity(productID int) (int, error)
+}
+
+type StockMovement struct {
+	ID            int64     `json:"id"`
+	ProductID     int       `json:"productID"`
+	Delta         int       `json:"delta"`
+	QuantityAfter int       `json:"quantityAfter"`
+	Reason        string    `json:"reason"`
+	ActorID       *int      `json:"actorID"`
+	Reference     string    `json:"reference"`
+	Note          string    `json:"note"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+type StockAdjustmentPayload struct {
+	Delta     int    `json:"delta" validate:"required"`
+	Reason    string `json:"reason" validate:"required,oneof=adjustment import return"`
+	Reference string `json:"reference" validate:"max=255"`
+	Note      string `json:"note" validate:"max=1000"`
+}
+
+type StockHistoryResponse struct {
+	ProductID      int             `json:"productID"`
+	Quantity       int             `json:"quantity"`
+	LedgerQuantity int             `json:"ledgerQuantity"`
+	Movements      []StockMovement `json:"movements"`
+}
+
+type AddressStore interface {
+	CreateAddress(Address) (int, error)
+	GetAddressesByUserID(userID int) ([]Address, error)
+	// GetAddressByID returns nil when the address does not exist.
+	GetAddressByID(id int) (*Address, error)
+	UpdateAddress(Address) error
+	DeleteAddress(id int) error
+}
+
+type ShippingStore interface {
+	CreateShippingZone(ShippingZone) error
+	GetShippingZones() ([]ShippingZone, error)
+	// GetShippingZoneForCountry returns the zone listing country, or the
+	// fallback zone, or nil when neither exists.
+	GetShippingZoneForCountry(country string) (*ShippingZone, error)
+	CreateShippingRate(ShippingRate) (int, error)
+	GetShippingRates(zone string) ([]ShippingRate, error)
+}
+
+type CartStore interface {
+	GetCartByUserID(userID int) (*Cart, error)
+	GetCartForUpdate(tx pgx.Tx, userID int) (*Cart, error)
+	SaveCartItemsTx(tx pgx.Tx, cartID int, items []CartItem) error
+	ClearCart(userID int) error
+	ClearCartTx(tx pgx.Tx, userID int) error
+}
+
+type PaymentStore interface {
+	CreatePayment(Payment) (int, error)
+	UpdatePayment(Payment) error
+	UpdatePaymentTx(tx pgx.Tx, payment Payment) error
+	GetPaymentsByOrderID(orderID int) ([]Payment, error)
+	GetPaymentByProviderIDForUpdate(tx pgx.Tx, provider, providerPaymentID string) (*Payment, error)
+	RecordWebhookEventTx(tx pgx.Tx, provider, eventID, eventType string, payload []byte) (bool, error)
+}
+
+type PaymentService interface {
+	StartPayment(order Order) (*Payment, error)
+}
+
+type IdempotencyStore interface {
+	Reserve(record IdempotencyRecord) (*IdempotencyRecord, bool, error)
+	SaveResponse(id int, status int, body []byte) error
+	Delete(id int) error
+}
+
+type Transactor interface {
+	WithTx(fn func(tx pgx.Tx) error) error
 }
 
 type BlacklistStore interface {
 	AddToBlacklist(token string, userID int, expiresAt time.Time) error
+	ConsumeToken(token string, userID int, expiresAt time.Time) (bool, error)
 	IsBlacklisted(token string) (bool, error)
+	IsSessionRevoked(familyID string) (bool, error)
 	CleanupExpiredTokens() error
 }
 
+// Session is one login of a user, covering every refresh token rotated from
+// it.
+type Session struct {
+	ID         int       `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	Current    bool      `json:"current"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	FamilyID   string    `json:"-"`
+}
+
+// SessionClient describes the client a session was started or last used
+// from.
+type SessionClient struct {
+	UserAgent string
+	IP        string
+}
+
 type LoginUserPayload struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
 }
 
 type TokenPair struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
-	ExpiresIn    int64  `json:"expires_in"`
+	AccessToken      string    `json:"access_token"`
+	RefreshToken     string    `json:"refresh_token"`
+	ExpiresIn        int64     `json:"expires_in"`
+	RefreshTokenID   string    `json:"-"`
+	FamilyID         string    `json:"-"`
+	RefreshExpiresAt time.Time `json:"-"`
 }
 
+// LoginResponse carries either the access token or, for users with two-factor
+// authentication, an MFA token to exchange at /login/mfa.
 type LoginResponse struct {
-	AccessToken string `json:"access_token"`
+	AccessToken string `json:"access_token,omitempty"`
 	ExpiresIn   int64  `json:"expires_in"`
 	Message     string `json:"message"`
+	MFARequired bool   `json:"mfa_required,omitempty"`
+	MFAToken    string `json:"mfa_token,omitempty"`
+}
+
+type LoginMFAPayload struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+type UserTOTP struct {
+	UserID       int
+	Secret       string
+	EnabledAt    *time.Time
+	LastUsedStep int64
+	CreatedAt    time.Time
+}
+
+type TOTPEnrolmentResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type TOTPCodePayload struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+type DisableTOTPPayload struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"`
 }
 
 type RefreshTokenPayload struct {
@@ -77,6 +306,29 @@ type LogoutPayload struct {
 	RefreshToken string `json:"refresh_token" validate:"required"`
 }
 
+type UpdateProfilePayload struct {
+	FirstName *string `json:"firstName" validate:"omitempty,min=1,max=255"`
+	LastName  *string `json:"lastName" validate:"omitempty,min=1,max=255"`
+}
+
+type ChangePasswordPayload struct {
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+	NewPassword     string `json:"newPassword" validate:"required,min=3,max=130"`
+}
+
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordPayload struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"newPassword" validate:"required,min=3,max=130"`
+}
+
+type RolePayload struct {
+	Role string `json:"role" validate:"required,oneof=customer staff admin"`
+}
+
 type BlacklistedToken struct {
 	ID        int       `json:"id"`
 	Token     string    `json:"token"`
@@ -85,31 +337,207 @@ type BlacklistedToken struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+type IdempotencyRecord struct {
+	ID             int
+	UserID         int
+	Key            string
+	Method         string
+	Path           string
+	RequestHash    string
+	ResponseStatus *int
+	ResponseBody   []byte
+	ExpiresAt      time.Time
+	CreatedAt      time.Time
+}
+
+type Payment struct {
+	ID                int         `json:"id"`
+	OrderID           int         `json:"orderID"`
+	Provider          string      `json:"provider"`
+	ProviderPaymentID *string     `json:"providerPaymentID"`
+	Amount            money.Money `json:"amount"`
+	Currency          string      `json:"currency"`
+	Status            string      `json:"status"`
+	FailureReason     string      `json:"failureReason,omitempty"`
+	CreatedAt         time.Time   `json:"createdAt"`
+	UpdatedAt         time.Time   `json:"updatedAt"`
+}
+
 type OrderItem struct {
-	ID        int       `json:"id"`
-	OrderID   int       `json:"orderID"`
-	ProductID int       `json:"productID"`
-	Quantity  int       `json:"quantity"`
-	Price     float64   `json:"price"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID           int         `json:"id"`
+	OrderID      int         `json:"orderID"`
+	ProductID    int         `json:"productID"`
+	ProductName  string      `json:"productName"`
+	ProductImage string      `json:"productImage"`
+	Quantity     int         `json:"quantity"`
+	Price        money.Money `json:"price"`
+	TaxCategory  string      `json:"taxCategory"`
+	TaxRate      string      `json:"taxRate"`
+	Tax          money.Money `json:"tax"`
+	CreatedAt    time.Time   `json:"createdAt"`
+}
+
+type OrderDetail struct {
+	Order
+	Items     []OrderItem         `json:"items"`
+	Discounts []OrderDiscount     `json:"discounts"`
+	History   []OrderStatusChange `json:"history"`
+}
+
+type OrderDiscount struct {
+	ID           int         `json:"id"`
+	OrderID      int         `json:"orderID"`
+	CouponID     int         `json:"couponID"`
+	CouponCode   string      `json:"couponCode"`
+	Type         string      `json:"type"`
+	Description  string      `json:"description"`
+	Amount       money.Money `json:"amount"`
+	FreeShipping bool        `json:"freeShipping"`
+	CreatedAt    time.Time   `json:"createdAt"`
+}
+
+type Coupon struct {
+	ID             int          `json:"id"`
+	Code           string       `json:"code"`
+	Type           string       `json:"type"`
+	Percent        *int         `json:"percent,omitempty"`
+	Amount         *money.Money `json:"amount,omitempty"`
+	Currency       string       `json:"currency"`
+	ProductID      *int         `json:"productID,omitempty"`
+	BuyQuantity    *int         `json:"buyQuantity,omitempty"`
+	GetQuantity    *int         `json:"getQuantity,omitempty"`
+	MinOrderValue  *money.Money `json:"minOrderValue,omitempty"`
+	StartsAt       *time.Time   `json:"startsAt,omitempty"`
+	EndsAt         *time.Time   `json:"endsAt,omitempty"`
+	MaxUses        *int         `json:"maxUses,omitempty"`
+	MaxUsesPerUser *int         `json:"maxUsesPerUser,omitempty"`
+	UsedCount      int          `json:"usedCount"`
+	CreatedAt      time.Time    `json:"createdAt"`
+}
+
+type CreateCouponPayload struct {
+	Code           string       `json:"code" validate:"required,max=64,alphanum"`
+	Type           string       `json:"type" validate:"required,oneof=percentage fixed_amount free_shipping buy_x_get_y"`
+	Percent        *int         `json:"percent" validate:"omitempty,min=1,max=100"`
+	Amount         *money.Money `json:"amount"`
+	ProductID      *int         `json:"productID"`
+	BuyQuantity    *int         `json:"buyQuantity" validate:"omitempty,min=1"`
+	GetQuantity    *int         `json:"getQuantity" validate:"omitempty,min=1"`
+	MinOrderValue  *money.Money `json:"minOrderValue"`
+	StartsAt       *time.Time   `json:"startsAt"`
+	EndsAt         *time.Time   `json:"endsAt"`
+	MaxUses        *int         `json:"maxUses" validate:"omitempty,min=1"`
+	MaxUsesPerUser *int         `json:"maxUsesPerUser" validate:"omitempty,min=1"`
+}
+
+type OrderStatusChange struct {
+	ID         int       `json:"id"`
+	OrderID    int       `json:"orderID"`
+	FromStatus *string   `json:"fromStatus"`
+	ToStatus   string    `json:"toStatus"`
+	ChangedBy  *int      `json:"changedBy"`
+	Note       string    `json:"note"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type CancelOrderPayload struct {
+	Reason string `json:"reason" validate:"max=500"`
+}
+
+type OrderFilter struct {
+	Status string
+	From   *time.Time
+	To     *time.Time
+	Page   int
+	Limit  int
+}
+
+type OrderListResponse struct {
+	Orders []Order `json:"orders"`
+	Page   int     `json:"page"`
+	Limit  int     `json:"limit"`
+	Total  int     `json:"total"`
 }
 
 type Product struct {
-	ID          int       `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Image       string    `json:"image"`
-	Price       float64   `json:"price"`
-	Quantity    int       `json:"quantity"`
-	CreatedAt   time.Time `json:"createdAt"`
+	ID          int           `json:"id"`
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Image       string        `json:"image"`
+	Price       money.Money   `json:"price"`
+	Prices      []money.Money `json:"prices"`
+	Quantity    int           `json:"quantity"`
+	Available   int           `json:"available"`
+	TaxCategory string        `json:"taxCategory"`
+	WeightGrams int           `json:"weightGrams"`
+	CreatedAt   time.Time     `json:"createdAt"`
 }
 
 type CreateProductPayload struct {
-	Name        string  `json:"name" validate:"required"`
-	Description string  `json:"description"`
-	Image       string  `json:"image"`
-	Price       float64 `json:"price" validate:"required"`
-	Quantity    int     `json:"quantity" validate:"required"`
+	Name        string        `json:"name" validate:"required"`
+	Description string        `json:"description"`
+	Image       string        `json:"image"`
+	Price       money.Money   `json:"price"`
+	Prices      []money.Money `json:"prices"`
+	Quantity    int           `json:"quantity" validate:"min=0"`
+	TaxCategory string        `json:"taxCategory" validate:"max=64"`
+	WeightGrams int           `json:"weightGrams" validate:"min=0"`
+}
+
+type ProductFilter struct {
+	Sort       string
+	Descending bool
+	Cursor     string
+	Limit      int
+	Currency   string
+	MinPrice   *money.Money
+	MaxPrice   *money.Money
+	InStock    bool
+}
+
+type ProductListResponse struct {
+	Products   []*Product `json:"products"`
+	NextCursor string     `json:"nextCursor,omitempty"`
+	Limit      int        `json:"limit"`
+	Total      int        `json:"total"`
+}
+
+type ProductSearchFilter struct {
+	// Query is a to_tsquery expression.
+	Query   string
+	Cursor  string
+	Limit   int
+	InStock bool
+}
+
+type ProductSearchResult struct {
+	Product
+	Rank float32 `json:"rank"`
+	// NameHighlight and Snippet mark matched terms with <mark></mark>.
+	NameHighlight string `json:"nameHighlight"`
+	Snippet       string `json:"snippet"`
+}
+
+type ProductSearchResponse struct {
+	Results    []ProductSearchResult `json:"results"`
+	NextCursor string                `json:"nextCursor,omitempty"`
+	Limit      int                   `json:"limit"`
+	Total      int                   `json:"total"`
+}
+
+// UpdateProductPayload holds the editable fields of a product. Stock is not
+// among them; it changes through stock adjustments only.
+type UpdateProductPayload struct {
+	Name        string      `json:"name" validate:"required"`
+	Description string      `json:"description"`
+	Image       string      `json:"image"`
+	Price       money.Money `json:"price"`
+	TaxCategory string      `json:"taxCategory" validate:"required,max=64"`
+	WeightGrams int         `json:"weightGrams" validate:"min=0"`
+}
+
+type SetProductPricesPayload struct {
+	Prices []money.Money `json:"prices"`
 }
 
 type CartCheckoutItem struct {
@@ -118,5 +546,123 @@ type CartCheckoutItem struct {
 }
 
 type CartCheckoutPayload struct {
-	Items []CartCheckoutItem `json:"items" validate:"required"`
+	Items          []CartCheckoutItem `json:"items" validate:"required"`
+	Currency       string             `json:"currency" validate:"omitempty,len=3,alpha"`
+	CouponCode     string             `json:"couponCode" validate:"omitempty,max=64"`
+	AddressID      *int               `json:"addressID"`
+	Address        *ShippingAddress   `json:"address"`
+	ShippingMethod string             `json:"shippingMethod" validate:"max=64"`
+}
+
+type StoredCartCheckoutPayload struct {
+	Currency       string           `json:"currency" validate:"omitempty,len=3,alpha"`
+	CouponCode     string           `json:"couponCode" validate:"omitempty,max=64"`
+	AddressID      *int             `json:"addressID"`
+	Address        *ShippingAddress `json:"address"`
+	ShippingMethod string           `json:"shippingMethod" validate:"max=64"`
+}
+
+// ShippingAddress is a postal address as entered at checkout and as
+// snapshotted onto orders.
+type ShippingAddress struct {
+	Recipient  string `json:"recipient" validate:"required,max=255"`
+	Line1      string `json:"line1" validate:"required,max=255"`
+	Line2      string `json:"line2" validate:"max=255"`
+	City       string `json:"city" validate:"required,max=128"`
+	Region     string `json:"region" validate:"max=64"`
+	PostalCode string `json:"postalCode" validate:"required,max=32"`
+	Country    string `json:"country" validate:"required,len=2,alpha"`
+	Phone      string `json:"phone" validate:"max=32"`
+}
+
+type Address struct {
+	ID     int    `json:"id"`
+	UserID int    `json:"userID"`
+	Label  string `json:"label"`
+	ShippingAddress
+	IsDefault bool      `json:"isDefault"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type AddressPayload struct {
+	Label string `json:"label" validate:"max=64"`
+	ShippingAddress
+	IsDefault bool `json:"isDefault"`
+}
+
+type ShippingZone struct {
+	Code                  string       `json:"code"`
+	Name                  string       `json:"name"`
+	Countries             []string     `json:"countries"`
+	FreeShippingThreshold *money.Money `json:"freeShippingThreshold,omitempty"`
+	CreatedAt             time.Time    `json:"createdAt"`
+}
+
+type ShippingRate struct {
+	ID             int         `json:"id"`
+	Zone           string      `json:"zone"`
+	Method         string      `json:"method"`
+	MaxWeightGrams *int        `json:"maxWeightGrams"`
+	Price          money.Money `json:"price"`
+	CreatedAt      time.Time   `json:"createdAt"`
+}
+
+type CreateShippingZonePayload struct {
+	Code                  string       `json:"code" validate:"required,max=32"`
+	Name                  string       `json:"name" validate:"required,max=255"`
+	Countries             []string     `json:"countries" validate:"dive,len=2,alpha"`
+	FreeShippingThreshold *money.Money `json:"freeShippingThreshold"`
+}
+
+type CreateShippingRatePayload struct {
+	Zone           string      `json:"zone" validate:"required,max=32"`
+	Method         string      `json:"method" validate:"required,max=64"`
+	MaxWeightGrams *int        `json:"maxWeightGrams" validate:"omitempty,min=1"`
+	Price          money.Money `json:"price"`
+}
+
+type TaxRule struct {
+	ID          int       `json:"id"`
+	Country     string    `json:"country"`
+	Region      string    `json:"region"`
+	TaxCategory string    `json:"taxCategory"`
+	Rate        string    `json:"rate"`
+	Name        string    `json:"name"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type CreateTaxRulePayload struct {
+	Country     string `json:"country" validate:"required,len=2,alpha"`
+	Region      string `json:"region" validate:"max=64"`
+	TaxCategory string `json:"taxCategory" validate:"max=64"`
+	Rate        string `json:"rate" validate:"required"`
+	Name        string `json:"name" validate:"max=255"`
+}
+
+type Cart struct {
+	ID        int         `json:"id"`
+	UserID    int         `json:"userID"`
+	Items     []CartItem  `json:"items"`
+	Total     money.Money `json:"total"`
+	CreatedAt time.Time   `json:"createdAt"`
+	UpdatedAt time.Time   `json:"updatedAt"`
+}
+
+type CartItem struct {
+	ID        int         `json:"id"`
+	CartID    int         `json:"cartID"`
+	ProductID int         `json:"productID"`
+	Quantity  int         `json:"quantity"`
+	UnitPrice money.Money `json:"unitPrice"`
+	CreatedAt time.Time   `json:"createdAt"`
+}
+
+type AddCartItemPayload struct {
+	ProductID int `json:"productID" validate:"required"`
+	Quantity  int `json:"quantity" validate:"required,min=1"`
+}
+
+type UpdateCartItemPayload struct {
+	Quantity int `json:"quantity" validate:"required,min=1"`
 }
@@ -0,0 +1,295 @@
+package money
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	DefaultCurrency = "USD"
+
+	// ColumnScale is the number of decimal places of the NUMERIC(10, 2)
+	// money columns in the database.
+	ColumnScale = 2
+
+	// MaxMajor bounds amounts in major units: the NUMERIC(10, 2) columns
+	// hold values below 10^8.
+	MaxMajor = 100_000_000
+)
+
+var ErrOutOfRange = errors.New("amount out of range")
+
+// zeroDecimalCurrencies are the ISO 4217 currencies without minor units.
+// Every other currency uses two decimal places; three-decimal currencies
+// such as BHD or KWD would not fit the NUMERIC(10, 2) columns.
+var zeroDecimalCurrencies = map[string]bool{
+	"BIF": true, "CLP": true, "DJF": true, "GNF": true, "ISK": true, "JPY": true,
+	"KMF": true, "KRW": true, "PYG": true, "RWF": true, "UGX": true, "VND": true,
+	"VUV": true, "XAF": true, "XOF": true, "XPF": true,
+}
+
+// ScaleOf returns the number of decimal places of currency's minor unit.
+func ScaleOf(currency string) int32 {
+	if zeroDecimalCurrencies[normalizeCurrency(currency)] {
+		return 0
+	}
+	return ColumnScale
+}
+
+func minorPerMajor(currency string) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(ScaleOf(currency))), nil)
+}
+
+// Money is an exact amount held as integer minor units (cents, or whole yen
+// for currencies without minor units) together with its ISO 4217 currency
+// code. Arithmetic between different currencies is a programming error and
+// panics.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+func New(minor int64, currency string) Money {
+	return Money{Amount: minor, Currency: normalizeCurrency(currency)}
+}
+
+func Zero(currency string) Money {
+	return New(0, currency)
+}
+
+// Parse reads a decimal string such as "12.34" or "-0.5". Values with more
+// decimal places than the currency has are rounded with Round.
+func Parse(s, currency string) (Money, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+	return FromMajor(r, currency)
+}
+
+// FromMajor converts an amount in major units (e.g. dollars) to Money. It
+// returns ErrOutOfRange when the rounded amount is not below MaxMajor.
+func FromMajor(r *big.Rat, currency string) (Money, error) {
+	perMajor := minorPerMajor(currency)
+	minor := roundToInt(new(big.Rat).Mul(r, new(big.Rat).SetInt(perMajor)))
+
+	limit := new(big.Int).Mul(big.NewInt(MaxMajor), perMajor)
+	if minor.CmpAbs(limit) >= 0 {
+		return Money{}, fmt.Errorf("%w: %s", ErrOutOfRange, r.FloatString(int(ScaleOf(currency))))
+	}
+
+	return New(minor.Int64(), currency), nil
+}
+
+// Round is the single rounding rule used for money: round half away from
+// zero to the nearest minor unit. It panics when the result does not fit in
+// int64.
+func Round(r *big.Rat) int64 {
+	q := roundToInt(r)
+	if !q.IsInt64() {
+		panic(fmt.Sprintf("money: %s overflows int64", r.FloatString(0)))
+	}
+	return q.Int64()
+}
+
+func roundToInt(r *big.Rat) *big.Int {
+	num := new(big.Int).Set(r.Num())
+	den := r.Denom()
+
+	neg := num.Sign() < 0
+	num.Abs(num)
+
+	q, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Mul(rem, big.NewInt(2)).Cmp(den) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	if neg {
+		q.Neg(q)
+	}
+
+	return q
+}
+
+func (m Money) Add(o Money) Money {
+	m.mustMatch(o)
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}
+}
+
+func (m Money) Sub(o Money) Money {
+	m.mustMatch(o)
+	return Money{Amount: m.Amount - o.Amount, Currency: m.Currency}
+}
+
+// Mul multiplies by a quantity and panics if the result overflows int64.
+func (m Money) Mul(n int) Money {
+	product := new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(int64(n)))
+	if !product.IsInt64() {
+		panic(fmt.Sprintf("money: %s * %d overflows int64", m, n))
+	}
+	return Money{Amount: product.Int64(), Currency: m.Currency}
+}
+
+// MulRat multiplies by an exact ratio (a tax rate, a discount, an exchange
+// rate) and rounds the result with Round.
+func (m Money) MulRat(r *big.Rat) Money {
+	v := new(big.Rat).Mul(new(big.Rat).SetInt64(m.Amount), r)
+	return Money{Amount: Round(v), Currency: m.Currency}
+}
+
+func (m Money) Cmp(o Money) int {
+	m.mustMatch(o)
+	switch {
+	case m.Amount < o.Amount:
+		return -1
+	case m.Amount > o.Amount:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// Major returns the amount in major units as an exact ratio.
+func (m Money) Major() *big.Rat {
+	return new(big.Rat).SetFrac(big.NewInt(m.Amount), minorPerMajor(m.Currency))
+}
+
+// WithCurrency returns the same major amount labelled with currency, in that
+// currency's minor units. Stores use it to attach the currency column to an
+// amount scanned before the currency was known. It does not convert between
+// currencies; use exchange.Convert for that. Rescaling an amount read from a
+// money column cannot leave the column range, so it panics if it does.
+func (m Money) WithCurrency(currency string) Money {
+	relabelled, err := FromMajor(m.Major(), currency)
+	if err != nil {
+		panic(fmt.Sprintf("money: %v", err))
+	}
+	return relabelled
+}
+
+// String formats the amount with the currency's number of decimal places,
+// without the currency code.
+func (m Money) String() string {
+	return m.Major().FloatString(int(ScaleOf(m.Currency)))
+}
+
+func (m Money) mustMatch(o Money) {
+	if m.Currency != o.Currency {
+		panic(fmt.Sprintf("money: currency mismatch %s != %s", m.Currency, o.Currency))
+	}
+}
+
+type jsonMoney struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// MarshalJSON encodes the amount as a decimal string so clients never see a
+// binary floating point value: {"amount":"12.34","currency":"USD"}.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonMoney{Amount: m.String(), Currency: normalizeCurrency(m.Currency)})
+}
+
+// UnmarshalJSON accepts the object form produced by MarshalJSON as well as a
+// bare JSON number or string, which is read in the default currency.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+
+	if len(data) > 0 && data[0] == '{' {
+		var v jsonMoney
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		parsed, err := Parse(v.Amount, v.Currency)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	}
+
+	var s string
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	} else {
+		var n json.Number
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("invalid amount %s", data)
+		}
+		s = n.String()
+	}
+
+	parsed, err := Parse(s, m.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// NumericValue lets pgx write Money to a NUMERIC column without going
+// through float64.
+func (m Money) NumericValue() (pgtype.Numeric, error) {
+	return pgtype.Numeric{Int: big.NewInt(m.Amount), Exp: -ScaleOf(m.Currency), Valid: true}, nil
+}
+
+// ScanNumeric lets pgx read a NUMERIC column into Money. The currency is not
+// stored in the column; it is kept if already set and defaults otherwise.
+// When the currency column is scanned afterwards, attach it with
+// WithCurrency so the amount is rescaled.
+func (m *Money) ScanNumeric(n pgtype.Numeric) error {
+	if !n.Valid {
+		return fmt.Errorf("cannot scan NULL into money")
+	}
+	if n.NaN || n.InfinityModifier != pgtype.Finite {
+		return fmt.Errorf("cannot scan non-finite numeric into money")
+	}
+
+	r := new(big.Rat).SetInt(n.Int)
+	exp := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(n.Exp))), nil)
+	if n.Exp < 0 {
+		r.Quo(r, new(big.Rat).SetInt(exp))
+	} else {
+		r.Mul(r, new(big.Rat).SetInt(exp))
+	}
+
+	scanned, err := FromMajor(r, m.Currency)
+	if err != nil {
+		return err
+	}
+	*m = scanned
+	return nil
+}
+
+func normalizeCurrency(currency string) string {
+	if currency == "" {
+		return DefaultCurrency
+	}
+	return strings.ToUpper(currency)
+}
+
+func abs(n int32) int32 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,306 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in       string
+		currency string
+		want     Money
+		wantErr  bool
+	}{
+		{in: "12.34", currency: "USD", want: Money{Amount: 1234, Currency: "USD"}},
+		{in: " 0.5 ", currency: "eur", want: Money{Amount: 50, Currency: "EUR"}},
+		{in: "-0.5", currency: "USD", want: Money{Amount: -50, Currency: "USD"}},
+		{in: "1.005", currency: "USD", want: Money{Amount: 101, Currency: "USD"}},
+		{in: "-1.005", currency: "USD", want: Money{Amount: -101, Currency: "USD"}},
+		{in: "10", currency: "", want: Money{Amount: 1000, Currency: "USD"}},
+		{in: "1000", currency: "JPY", want: Money{Amount: 1000, Currency: "JPY"}},
+		{in: "99.5", currency: "JPY", want: Money{Amount: 100, Currency: "JPY"}},
+		{in: "99999999.99", currency: "USD", want: Money{Amount: 9999999999, Currency: "USD"}},
+		{in: "-99999999.99", currency: "USD", want: Money{Amount: -9999999999, Currency: "USD"}},
+		{in: "99999999", currency: "JPY", want: Money{Amount: 99999999, Currency: "JPY"}},
+		{in: "abc", currency: "USD", wantErr: true},
+		{in: "100000000", currency: "USD", wantErr: true},
+		{in: "-100000000", currency: "USD", wantErr: true},
+		{in: "99999999.995", currency: "USD", wantErr: true},
+		{in: "100000000", currency: "JPY", wantErr: true},
+		{in: "184467440737095517.16", currency: "USD", wantErr: true},
+		{in: "-92233720368547758.09", currency: "USD", wantErr: true},
+		{in: "", currency: "USD", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.in, tt.currency)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Parse(%q, %q) = %v, want error", tt.in, tt.currency, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q) error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q, %q) = %+v, want %+v", tt.in, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		num, den int64
+		want     int64
+	}{
+		{num: 5, den: 2, want: 3},
+		{num: -5, den: 2, want: -3},
+		{num: 7, den: 3, want: 2},
+		{num: -7, den: 3, want: -2},
+		{num: 8, den: 3, want: 3},
+		{num: 4, den: 1, want: 4},
+		{num: 0, den: 1, want: 0},
+		{num: 1, den: 200, want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := Round(big.NewRat(tt.num, tt.den)); got != tt.want {
+			t.Errorf("Round(%d/%d) = %d, want %d", tt.num, tt.den, got, tt.want)
+		}
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	tests := []struct {
+		in   Money
+		want string
+	}{
+		{in: New(1234, "usd"), want: `{"amount":"12.34","currency":"USD"}`},
+		{in: New(-5, "EUR"), want: `{"amount":"-0.05","currency":"EUR"}`},
+		{in: New(1000, "JPY"), want: `{"amount":"1000","currency":"JPY"}`},
+		{in: Money{Amount: 100}, want: `{"amount":"1.00","currency":"USD"}`},
+	}
+
+	for _, tt := range tests {
+		got, err := json.Marshal(tt.in)
+		if err != nil {
+			t.Errorf("Marshal(%+v) error: %v", tt.in, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("Marshal(%+v) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		preset  string
+		want    Money
+		wantErr bool
+	}{
+		{in: `{"amount":"12.34","currency":"eur"}`, want: Money{Amount: 1234, Currency: "EUR"}},
+		{in: `{"amount":"1000","currency":"JPY"}`, want: Money{Amount: 1000, Currency: "JPY"}},
+		{in: `"9.99"`, want: Money{Amount: 999, Currency: "USD"}},
+		{in: `9.99`, want: Money{Amount: 999, Currency: "USD"}},
+		{in: `"500"`, preset: "JPY", want: Money{Amount: 500, Currency: "JPY"}},
+		{in: `{"amount":"x","currency":"USD"}`, wantErr: true},
+		{in: `true`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got := Money{Currency: tt.preset}
+		err := json.Unmarshal([]byte(tt.in), &got)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Unmarshal(%s) = %+v, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unmarshal(%s) error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Unmarshal(%s) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNumericRoundTrip(t *testing.T) {
+	tests := []Money{
+		New(1234, "USD"),
+		New(-1, "USD"),
+		New(0, "EUR"),
+		New(99999999, "USD"),
+		New(1000, "JPY"),
+		New(7, "KRW"),
+	}
+
+	m := pgtype.NewMap()
+	for _, want := range tests {
+		buf, err := m.Encode(pgtype.NumericOID, pgtype.TextFormatCode, want, nil)
+		if err != nil {
+			t.Errorf("encode %+v: %v", want, err)
+			continue
+		}
+
+		// The column is NUMERIC(10, 2), so Postgres returns every value with
+		// two decimal places whatever the currency.
+		stored, ok := new(big.Rat).SetString(string(buf))
+		if !ok {
+			t.Errorf("encode %+v produced %q", want, buf)
+			continue
+		}
+		column := []byte(stored.FloatString(ColumnScale))
+
+		// Stores scan the amount before the currency column and attach the
+		// currency afterwards.
+		var scanned Money
+		if err := m.Scan(pgtype.NumericOID, pgtype.TextFormatCode, column, &scanned); err != nil {
+			t.Errorf("scan %s: %v", column, err)
+			continue
+		}
+		if got := scanned.WithCurrency(want.Currency); got != want {
+			t.Errorf("round trip via %s = %+v, want %+v", column, got, want)
+		}
+
+		preset := Money{Currency: want.Currency}
+		if err := m.Scan(pgtype.NumericOID, pgtype.TextFormatCode, column, &preset); err != nil {
+			t.Errorf("scan %s: %v", column, err)
+			continue
+		}
+		if preset != want {
+			t.Errorf("round trip with preset currency via %s = %+v, want %+v", column, preset, want)
+		}
+	}
+}
+
+func TestNumericValue(t *testing.T) {
+	tests := []struct {
+		in      Money
+		wantInt int64
+		wantExp int32
+	}{
+		{in: New(1234, "USD"), wantInt: 1234, wantExp: -2},
+		{in: New(1000, "JPY"), wantInt: 1000, wantExp: 0},
+	}
+
+	for _, tt := range tests {
+		n, err := tt.in.NumericValue()
+		if err != nil {
+			t.Errorf("NumericValue(%+v) error: %v", tt.in, err)
+			continue
+		}
+		if !n.Valid || n.Int.Int64() != tt.wantInt || n.Exp != tt.wantExp {
+			t.Errorf("NumericValue(%+v) = %v e%d, want %d e%d", tt.in, n.Int, n.Exp, tt.wantInt, tt.wantExp)
+		}
+	}
+}
+
+func TestScanNumericRejectsInvalid(t *testing.T) {
+	tests := []pgtype.Numeric{
+		{},
+		{NaN: true, Valid: true},
+		{InfinityModifier: pgtype.Infinity, Valid: true},
+	}
+
+	for _, n := range tests {
+		var m Money
+		if err := m.ScanNumeric(n); err == nil {
+			t.Errorf("ScanNumeric(%+v) = %+v, want error", n, m)
+		}
+	}
+}
+
+func TestCurrencyMismatchPanics(t *testing.T) {
+	tests := []struct {
+		name string
+		op   func()
+	}{
+		{name: "Add", op: func() { New(1, "USD").Add(New(1, "EUR")) }},
+		{name: "Sub", op: func() { New(1, "USD").Sub(New(1, "EUR")) }},
+		{name: "Cmp", op: func() { New(1, "USD").Cmp(New(1, "JPY")) }},
+	}
+
+	for _, tt := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s with mismatched currencies did not panic", tt.name)
+				}
+			}()
+			tt.op()
+		}()
+	}
+}
+
+func TestMulOverflowPanics(t *testing.T) {
+	tests := []struct {
+		in Money
+		n  int
+	}{
+		{in: New(9999999999, "USD"), n: 1 << 40},
+		{in: New(-9999999999, "USD"), n: 1 << 40},
+		{in: New(math.MinInt64, "USD"), n: -1},
+	}
+
+	for _, tt := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%+v.Mul(%d) did not panic", tt.in, tt.n)
+				}
+			}()
+			tt.in.Mul(tt.n)
+		}()
+	}
+
+	if got := New(9999999999, "USD").Mul(1000); got.Amount != 9999999999000 {
+		t.Errorf("Mul(1000) = %+v, want 9999999999000", got)
+	}
+}
+
+func TestWithCurrency(t *testing.T) {
+	tests := []struct {
+		in       Money
+		currency string
+		want     Money
+	}{
+		{in: New(100000, ""), currency: "JPY", want: New(1000, "JPY")},
+		{in: New(1234, "USD"), currency: "EUR", want: New(1234, "EUR")},
+		{in: New(5, "JPY"), currency: "USD", want: New(500, "USD")},
+	}
+
+	for _, tt := range tests {
+		if got := tt.in.WithCurrency(tt.currency); got != tt.want {
+			t.Errorf("%+v.WithCurrency(%q) = %+v, want %+v", tt.in, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestFromMajorOutOfRange(t *testing.T) {
+	tests := []struct {
+		in       *big.Rat
+		currency string
+	}{
+		{in: big.NewRat(MaxMajor, 1), currency: "USD"},
+		{in: big.NewRat(-MaxMajor, 1), currency: "JPY"},
+		{in: new(big.Rat).SetFrac(new(big.Int).Lsh(big.NewInt(1), 70), big.NewInt(1)), currency: "USD"},
+	}
+
+	for _, tt := range tests {
+		if got, err := FromMajor(tt.in, tt.currency); !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("FromMajor(%s, %q) = %+v, %v, want ErrOutOfRange", tt.in, tt.currency, got, err)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package address
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"github.com/mikeudacha/paybuy/models"
+	"github.com/mikeudacha/paybuy/services/auth"
+	"github.com/mikeudacha/paybuy/utils"
+)
+
+type Handler struct {
+	store          models.AddressStore
+	userStore      models.UserStore
+	blacklistStore *auth.BlacklistStore
+}
+
+func NewHandler(store models.AddressStore, userStore models.UserStore, blacklistStore *auth.BlacklistStore) *Handler {
+	return &Handler{
+		store:          store,
+		userStore:      userStore,
+		blacklistStore: blacklistStore,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/users/me/addresses", auth.WithJWTAuth(h.handleGetAddresses, h.userStore, h.blacklistStore)).Methods(http.MethodGet)
+	router.HandleFunc("/users/me/addresses", auth.WithJWTAuth(h.handleCreateAddress, h.userStore, h.blacklistStore)).Methods(http.MethodPost)
+	router.HandleFunc("/users/me/addresses/{addressID}", auth.WithJWTAuth(h.handleGetAddress, h.userStore, h.blacklistStore)).Methods(http.MethodGet)
+	router.HandleFunc("/users/me/addresses/{addressID}", auth.WithJWTAuth(h.handleUpdateAddress, h.userStore, h.blacklistStore)).Methods(http.MethodPut)
+	router.HandleFunc("/users/me/addresses/{addressID}", auth.WithJWTAuth(h.handleDeleteAddress, h.userStore, h.blacklistStore)).Methods(http.MethodDelete)
+}
+
+func (h *Handler) handleGetAddresses(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	addresses, err := h.store.GetAddressesByUserID(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, addresses)
+}
+
+func (h *Handler) handleGetAddress(w http.ResponseWriter, r *http.Request) {
+	address, ok := h.getOwnAddress(w, r)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, address)
+}
+
+func (h *Handler) handleCreateAddress(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	payload, ok := parseAddressPayload(w, r)
+	if !ok {
+		return
+	}
+
+	address := models.Address{
+		UserID:          userID,
+		Label:           payload.Label,
+		ShippingAddress: payload.ShippingAddress,
+		IsDefault:       payload.IsDefault,
+	}
+
+	id, err := h.store.CreateAddress(address)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	created, err := h.store.GetAddressByID(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, created)
+}
+
+func (h *Handler) handleUpdateAddress(w http.ResponseWriter, r *http.Request) {
+	address, ok := h.getOwnAddress(w, r)
+	if !ok {
+		return
+	}
+
+	payload, ok := parseAddressPayload(w, r)
+	if !ok {
+		return
+	}
+
+	address.Label = payload.Label
+	address.ShippingAddress = payload.ShippingAddress
+	address.IsDefault = payload.IsDefault
+
+	if err := h.store.UpdateAddress(*address); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	updated, err := h.store.GetAddressByID(address.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, updated)
+}
+
+func (h *Handler) handleDeleteAddress(w http.ResponseWriter, r *http.Request) {
+	address, ok := h.getOwnAddress(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.DeleteAddress(address.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "Address deleted",
+	})
+}
+
+// getOwnAddress loads the address named in the URL and writes a 404 unless it
+// belongs to the authenticated user.
+func (h *Handler) getOwnAddress(w http.ResponseWriter, r *http.Request) (*models.Address, bool) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	addressID, err := getAddressIDFromRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+
+	address, err := h.store.GetAddressByID(addressID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if address == nil || address.UserID != userID {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("address not found"))
+		return nil, false
+	}
+
+	return address, true
+}
+
+func parseAddressPayload(w http.ResponseWriter, r *http.Request) (*models.AddressPayload, bool) {
+	var payload models.AddressPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return nil, false
+	}
+
+	return &payload, true
+}
+
+func getAddressIDFromRequest(r *http.Request) (int, error) {
+	vars := mux.Vars(r)
+	str, ok := vars["addressID"]
+	if !ok {
+		return 0, fmt.Errorf("missing address ID")
+	}
+
+	addressID, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address ID")
+	}
+
+	return addressID, nil
+}
@@ -0,0 +1,193 @@
+package address
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mikeudacha/paybuy/db"
+	"github.com/mikeudacha/paybuy/models"
+)
+
+const addressColumns = `id, user_id, label, recipient, line1, line2, city, region, postal_code, country, phone,
+	is_default, created_at, updated_at`
+
+type Store struct {
+	pool *pgxpool.Pool
+}
+
+func NewStore(pool *pgxpool.Pool) *Store {
+	return &Store{pool: pool}
+}
+
+// CreateAddress adds an address to the user's book. A default address
+// replaces the user's previous default.
+func (s *Store) CreateAddress(address models.Address) (int, error) {
+	ctx := context.Background()
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	if address.IsDefault {
+		if err := clearDefault(tx, address.UserID); err != nil {
+			return 0, err
+		}
+	}
+
+	var id int
+	query := `
+		INSERT INTO addresses (user_id, label, recipient, line1, line2, city, region, postal_code, country, phone, is_default)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id
+	`
+	err = tx.QueryRow(ctx, query,
+		address.UserID,
+		address.Label,
+		address.Recipient,
+		address.Line1,
+		address.Line2,
+		address.City,
+		strings.ToUpper(address.Region),
+		address.PostalCode,
+		strings.ToUpper(address.Country),
+		address.Phone,
+		address.IsDefault,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit(ctx)
+}
+
+func (s *Store) GetAddressesByUserID(userID int) ([]models.Address, error) {
+	query := `SELECT ` + addressColumns + ` FROM addresses WHERE user_id = $1 ORDER BY is_default DESC, id`
+	rows, err := s.pool.Query(context.Background(), query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	addresses := make([]models.Address, 0)
+	for rows.Next() {
+		a, err := scanRowsIntoAddress(rows)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, *a)
+	}
+
+	return addresses, rows.Err()
+}
+
+func (s *Store) GetAddressByID(id int) (*models.Address, error) {
+	query := `SELECT ` + addressColumns + ` FROM addresses WHERE id = $1`
+	rows, err := s.pool.Query(context.Background(), query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		return scanRowsIntoAddress(rows)
+	}
+
+	return nil, rows.Err()
+}
+
+func (s *Store) UpdateAddress(address models.Address) error {
+	ctx := context.Background()
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if address.IsDefault {
+		if err := clearDefault(tx, address.UserID); err != nil {
+			return err
+		}
+	}
+
+	query := `
+		UPDATE addresses
+		SET label = $1, recipient = $2, line1 = $3, line2 = $4, city = $5, region = $6,
+			postal_code = $7, country = $8, phone = $9, is_default = $10, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $11
+	`
+	_, err = tx.Exec(ctx, query,
+		address.Label,
+		address.Recipient,
+		address.Line1,
+		address.Line2,
+		address.City,
+		strings.ToUpper(address.Region),
+		address.PostalCode,
+		strings.ToUpper(address.Country),
+		address.Phone,
+		address.IsDefault,
+		address.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *Store) DeleteAddress(id int) error {
+	_, err := s.pool.Exec(context.Background(), `DELETE FROM addresses WHERE id = $1`, id)
+	return err
+}
+
+func clearDefault(q db.Querier, userID int) error {
+	_, err := q.Exec(context.Background(), `UPDATE addresses SET is_default = FALSE WHERE user_id = $1 AND is_default`, userID)
+	return err
+}
+
+func scanRowsIntoAddress(rows pgx.Rows) (*models.Address, error) {
+	address := new(models.Address)
+
+	err := rows.Scan(
+		&address.ID,
+		&address.UserID,
+		&address.Label,
+		&address.Recipient,
+		&address.Line1,
+		&address.Line2,
+		&address.City,
+		&address.Region,
+		&address.PostalCode,
+		&address.Country,
+		&address.Phone,
+		&address.IsDefault,
+		&address.CreatedAt,
+		&address.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return address, nil
+}
+
+// Format renders a as the multi-line text stored in orders.address.
+func Format(a models.ShippingAddress) string {
+	lines := []string{a.Recipient, a.Line1}
+	if a.Line2 != "" {
+		lines = append(lines, a.Line2)
+	}
+
+	city := a.City
+	if a.Region != "" {
+		city += ", " + a.Region
+	}
+	lines = append(lines, city+" "+a.PostalCode, strings.ToUpper(a.Country))
+
+	return strings.Join(lines, "\n")
+}
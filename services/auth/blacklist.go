@@ -31,6 +31,24 @@ func (s *BlacklistStore) AddToBlacklist(token string, userID int, expiresAt time
 	return nil
 }
 
+// ConsumeToken blacklists a single-use token and reports whether this call
+// was the one that did so. Concurrent callers race on the insert, so exactly
+// one of them gets true.
+func (s *BlacklistStore) ConsumeToken(token string, userID int, expiresAt time.Time) (bool, error) {
+	query := `
+		INSERT INTO blacklisted_tokens (token, user_id, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (token) DO NOTHING
+	`
+
+	tag, err := s.db.Exec(context.Background(), query, token, userID, expiresAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to consume token: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
 func (s *BlacklistStore) IsBlacklisted(token string) (bool, error) {
 	query := `
 		SELECT EXISTS(
@@ -48,6 +66,20 @@ func (s *BlacklistStore) IsBlacklisted(token string) (bool, error) {
 	return exists, nil
 }
 
+// IsSessionRevoked reports whether the session of familyID was logged out,
+// so access tokens issued for it stop working before they expire.
+func (s *BlacklistStore) IsSessionRevoked(familyID string) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM sessions WHERE family_id = $1 AND revoked_at IS NOT NULL)`
+
+	var revoked bool
+	err := s.db.QueryRow(context.Background(), query, familyID).Scan(&revoked)
+	if err != nil {
+		return false, fmt.Errorf("failed to check session: %w", err)
+	}
+
+	return revoked, nil
+}
+
 func (s *BlacklistStore) CleanupExpiredTokens() error {
 	query := `DELETE FROM blacklisted_tokens WHERE expires_at <= NOW()`
 
@@ -15,11 +15,21 @@ import (
 
 type contextKey string
 
-const UserKey contextKey = "userID"
+const (
+	UserKey    contextKey = "userID"
+	SessionKey contextKey = "sessionFamilyID"
+)
+
+// MFATokenTTL is how long a user has to enter their second factor after the
+// password step of login.
+const MFATokenTTL = 5 * time.Minute
 
 type JWTClaims struct {
-	UserID    string `json:"userID"`
-	TokenType string `json:"tokenType"`
+	UserID       string   `json:"userID"`
+	TokenType    string   `json:"tokenType"`
+	Roles        []string `json:"roles,omitempty"`
+	FamilyID     string   `json:"fid,omitempty"`
+	TokenVersion int      `json:"ver,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -48,6 +58,13 @@ func WithJWTAuth(handlerFunc http.HandlerFunc, store models.UserStore, blacklist
 			}
 		}
 		claims := token.Claims.(*JWTClaims)
+		if blacklistStore != nil && claims.FamilyID != "" {
+			revoked, err := blacklistStore.IsSessionRevoked(claims.FamilyID)
+			if err != nil || revoked {
+				permissionDenied(w)
+				return
+			}
+		}
 		str := claims.UserID
 
 		userID, err := strconv.Atoi(str)
@@ -63,13 +80,24 @@ func WithJWTAuth(handlerFunc http.HandlerFunc, store models.UserStore, blacklist
 		}
 		ctx := r.Context()
 		ctx = context.WithValue(ctx, UserKey, u.ID)
+		ctx = context.WithValue(ctx, RolesKey, claims.Roles)
+		ctx = context.WithValue(ctx, SessionKey, claims.FamilyID)
 		r = r.WithContext(ctx)
 
 		handlerFunc(w, r)
 	}
 }
 
-func CreateJWT(secret []byte, userID int, tokenType string) (string, error) {
+func CreateJWT(secret []byte, userID int, tokenType string, roles []string) (string, error) {
+	claims, err := newClaims(userID, tokenType, roles)
+	if err != nil {
+		return "", err
+	}
+
+	return signClaims(secret, claims)
+}
+
+func newClaims(userID int, tokenType string, roles []string) (*JWTClaims, error) {
 	cfg := config.LoadConfig()
 
 	var expiration time.Duration
@@ -79,38 +107,60 @@ func CreateJWT(secret []byte, userID int, tokenType string) (string, error) {
 	} else if tokenType == "refresh" {
 		jwtTTL, _ := strconv.Atoi(cfg.JWTRefreshExpirationInSeconds)
 		expiration = time.Second * time.Duration(jwtTTL)
+	} else if tokenType == "mfa" {
+		expiration = MFATokenTTL
 	} else {
-		return "", fmt.Errorf("invalid token type: %s", tokenType)
+		return nil, fmt.Errorf("invalid token type: %s", tokenType)
 	}
 
-	claims := &JWTClaims{
+	return &JWTClaims{
 		UserID:    strconv.Itoa(userID),
 		TokenType: tokenType,
+		Roles:     roles,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 		},
-	}
+	}, nil
+}
 
+func signClaims(secret []byte, claims *JWTClaims) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(secret)
-	if err != nil {
-		return "", err
-	}
-
-	return tokenString, err
+	return token.SignedString(secret)
 }
 
-func CreateTokenPair(userID int) (*models.TokenPair, error) {
+// CreateTokenPair issues an access token carrying roles and a refresh token
+// with a fresh jti, both tied to the session familyID. The refresh token also
+// carries the user's tokenVersion. Roles are not put in the refresh token; they
+// are reloaded on refresh so grants and revocations apply from the next
+// access token. Callers record the refresh token with RefreshTokenStore.
+func CreateTokenPair(userID int, roles []string, familyID string, tokenVersion int) (*models.TokenPair, error) {
 	cfg := config.LoadConfig()
 
-	accessToken, err := CreateJWT([]byte(cfg.JWTSecret), userID, "access")
+	accessClaims, err := newClaims(userID, "access", roles)
 	if err != nil {
 		return nil, err
 	}
+	accessClaims.FamilyID = familyID
 
-	refreshToken, err := CreateJWT([]byte(cfg.JWTRefreshSecret), userID, "refresh")
+	accessToken, err := signClaims([]byte(cfg.JWTSecret), accessClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshClaims, err := newClaims(userID, "refresh", nil)
+	if err != nil {
+		return nil, err
+	}
+	refreshClaims.ID, err = newTokenID()
+	if err != nil {
+		return nil, err
+	}
+	refreshClaims.FamilyID = familyID
+	refreshClaims.TokenVersion = tokenVersion
+
+	refreshToken, err := signClaims([]byte(cfg.JWTRefreshSecret), refreshClaims)
 	if err != nil {
 		return nil, err
 	}
@@ -119,9 +169,12 @@ func CreateTokenPair(userID int) (*models.TokenPair, error) {
 	expiresIn := int64(jwtTTL)
 
 	return &models.TokenPair{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		ExpiresIn:    expiresIn,
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		ExpiresIn:        expiresIn,
+		RefreshTokenID:   refreshClaims.ID,
+		FamilyID:         familyID,
+		RefreshExpiresAt: refreshClaims.ExpiresAt.Time,
 	}, nil
 }
 
@@ -129,7 +182,7 @@ func ValidateJWT(tokenString string, expectedType string) (*jwt.Token, error) {
 	cfg := config.LoadConfig()
 
 	var secret []byte
-	if expectedType == "access" {
+	if expectedType == "access" || expectedType == "mfa" {
 		secret = []byte(cfg.JWTSecret)
 	} else if expectedType == "refresh" {
 		secret = []byte(cfg.JWTRefreshSecret)
@@ -157,35 +210,6 @@ func ValidateJWT(tokenString string, expectedType string) (*jwt.Token, error) {
 	return token, nil
 }
 
-func RefreshAccessToken(refreshToken string, blacklistStore *BlacklistStore) (*models.TokenPair, error) {
-	token, err := ValidateJWT(refreshToken, "refresh")
-	if err != nil {
-		return nil, fmt.Errorf("invalid refresh token: %w", err)
-	}
-
-	if !token.Valid {
-		return nil, fmt.Errorf("invalid refresh token")
-	}
-
-	if blacklistStore != nil {
-		isBlacklisted, err := blacklistStore.IsBlacklisted(refreshToken)
-		if err != nil {
-			return nil, fmt.Errorf("failed to check blacklist: %w", err)
-		}
-		if isBlacklisted {
-			return nil, fmt.Errorf("refresh token is blacklisted")
-		}
-	}
-
-	claims := token.Claims.(*JWTClaims)
-	userID, err := strconv.Atoi(claims.UserID)
-	if err != nil {
-		return nil, fmt.Errorf("invalid user ID in token: %w", err)
-	}
-
-	return CreateTokenPair(userID)
-}
-
 func permissionDenied(w http.ResponseWriter) {
 	utils.WriteError(w, http.StatusForbidden, fmt.Errorf("permission denied"))
 }
@@ -198,3 +222,10 @@ func GetUserIDFromContext(ctx context.Context) int {
 
 	return userID
 }
+
+// GetSessionFamilyFromContext returns the refresh token family of the
+// session the access token was issued for, or "" for tokens without one.
+func GetSessionFamilyFromContext(ctx context.Context) string {
+	familyID, _ := ctx.Value(SessionKey).(string)
+	return familyID
+}
@@ -0,0 +1,350 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mikeudacha/paybuy/models"
+)
+
+const SecurityEventRefreshTokenReuse = "refresh_token_reuse"
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used, all sessions of this login have been revoked")
+)
+
+// RefreshTokenStore tracks issued refresh tokens so each one can be used
+// exactly once. Tokens from one login share a family, which is recorded as a
+// session; presenting a token that was already rotated means it was copied,
+// so the whole family is revoked.
+type RefreshTokenStore struct {
+	db *pgxpool.Pool
+}
+
+func NewRefreshTokenStore(db *pgxpool.Pool) *RefreshTokenStore {
+	return &RefreshTokenStore{db: db}
+}
+
+// Issue starts a new token family and session for a fresh login.
+func (s *RefreshTokenStore) Issue(userID int, roles []string, client models.SessionClient) (*models.TokenPair, error) {
+	familyID, err := newTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+
+	var tokenVersion int
+	if err := s.db.QueryRow(ctx, `SELECT token_version FROM users WHERE id = $1`, userID).Scan(&tokenVersion); err != nil {
+		return nil, err
+	}
+
+	pair, err := CreateTokenPair(userID, roles, familyID, tokenVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `INSERT INTO refresh_tokens (jti, family_id, user_id, expires_at) VALUES ($1, $2, $3, $4)`
+	if _, err := tx.Exec(ctx, query, pair.RefreshTokenID, familyID, userID, pair.RefreshExpiresAt); err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	if err := touchSessionTx(ctx, tx, userID, familyID, pair.RefreshExpiresAt, client); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+// Refresh exchanges refreshToken for a new pair in the same family and marks
+// it rotated in the same transaction. Roles are reloaded from store.
+func (s *RefreshTokenStore) Refresh(refreshToken string, store models.UserStore, client models.SessionClient) (*models.TokenPair, error) {
+	token, err := ValidateJWT(refreshToken, "refresh")
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	claims := token.Claims.(*JWTClaims)
+	userID, err := strconv.Atoi(claims.UserID)
+	if err != nil || claims.ID == "" || claims.FamilyID == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	u, err := store.GetUserByID(userID)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if claims.TokenVersion != u.TokenVersion {
+		return nil, fmt.Errorf("refresh token has been revoked")
+	}
+
+	roles, err := store.GetUserRoles(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user roles: %w", err)
+	}
+
+	pair, err := CreateTokenPair(userID, roles, claims.FamilyID, u.TokenVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE refresh_tokens SET rotated_at = NOW(), replaced_by = $2
+		WHERE jti = $1 AND user_id = $3 AND rotated_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()
+	`
+	tag, err := tx.Exec(ctx, query, claims.ID, pair.RefreshTokenID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, s.rejectTx(ctx, tx, claims, userID)
+	}
+
+	query = `INSERT INTO refresh_tokens (jti, family_id, user_id, expires_at) VALUES ($1, $2, $3, $4)`
+	if _, err := tx.Exec(ctx, query, pair.RefreshTokenID, claims.FamilyID, userID, pair.RefreshExpiresAt); err != nil {
+		return nil, err
+	}
+
+	if err := touchSessionTx(ctx, tx, userID, claims.FamilyID, pair.RefreshExpiresAt, client); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+// rejectTx works out why a token could not be rotated. A token that was
+// already rotated is being reused: its family is revoked and the event is
+// recorded before the transaction commits.
+func (s *RefreshTokenStore) rejectTx(ctx context.Context, tx pgx.Tx, claims *JWTClaims, userID int) error {
+	var rotated bool
+	query := `SELECT rotated_at IS NOT NULL FROM refresh_tokens WHERE jti = $1 AND user_id = $2`
+	err := tx.QueryRow(ctx, query, claims.ID, userID).Scan(&rotated)
+	if err == pgx.ErrNoRows {
+		return ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return err
+	}
+	if !rotated {
+		return fmt.Errorf("refresh token has been revoked")
+	}
+
+	if err := revokeFamily(ctx, tx, claims.FamilyID); err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO security_events (user_id, type, details)
+		VALUES ($1, $2, jsonb_build_object('jti', $3::text, 'family_id', $4::text))
+	`
+	if _, err := tx.Exec(ctx, query, userID, SecurityEventRefreshTokenReuse, claims.ID, claims.FamilyID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	return ErrRefreshTokenReused
+}
+
+// RevokeFamily ends the login that refreshToken belongs to. Tokens that fail
+// validation are ignored since they cannot be refreshed anyway.
+func (s *RefreshTokenStore) RevokeFamily(refreshToken string) error {
+	token, err := ValidateJWT(refreshToken, "refresh")
+	if err != nil || !token.Valid {
+		return nil
+	}
+
+	claims := token.Claims.(*JWTClaims)
+	if claims.FamilyID == "" {
+		return nil
+	}
+
+	ctx := context.Background()
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := revokeFamily(ctx, tx, claims.FamilyID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// RevokeUser ends every session of the user.
+func (s *RefreshTokenStore) RevokeUser(userID int) error {
+	ctx := context.Background()
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	query = `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetSessions lists the user's sessions that can still be refreshed, most
+// recently used first.
+func (s *RefreshTokenStore) GetSessions(userID int) ([]models.Session, error) {
+	query := `
+		SELECT id, family_id, user_agent, ip, created_at, last_used_at, expires_at
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_used_at DESC, id DESC
+	`
+	rows, err := s.db.Query(context.Background(), query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]models.Session, 0)
+	for rows.Next() {
+		var session models.Session
+		err := rows.Scan(
+			&session.ID,
+			&session.FamilyID,
+			&session.UserAgent,
+			&session.IP,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.ExpiresAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// RevokeSession logs out one session of the user and reports false when the
+// user has no active session with that ID.
+func (s *RefreshTokenStore) RevokeSession(userID, sessionID int) (bool, error) {
+	ctx := context.Background()
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var familyID string
+	query := `SELECT family_id FROM sessions WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	err = tx.QueryRow(ctx, query, sessionID, userID).Scan(&familyID)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := revokeFamily(ctx, tx, familyID); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+func (s *RefreshTokenStore) CleanupExpiredTokens() error {
+	ctx := context.Background()
+
+	if _, err := s.db.Exec(ctx, `DELETE FROM refresh_tokens WHERE expires_at <= NOW()`); err != nil {
+		return fmt.Errorf("failed to cleanup expired refresh tokens: %w", err)
+	}
+	if _, err := s.db.Exec(ctx, `DELETE FROM sessions WHERE expires_at <= NOW()`); err != nil {
+		return fmt.Errorf("failed to cleanup expired sessions: %w", err)
+	}
+
+	return nil
+}
+
+func (s *RefreshTokenStore) CleanupExpiredTokensPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			if err := s.CleanupExpiredTokens(); err != nil {
+				fmt.Printf("Failed to cleanup expired refresh tokens: %v\n", err)
+			}
+		}
+	}()
+}
+
+// touchSessionTx records a login or refresh of the session familyID. Families
+// issued before sessions were tracked get their session on first refresh.
+func touchSessionTx(ctx context.Context, tx pgx.Tx, userID int, familyID string, expiresAt time.Time, client models.SessionClient) error {
+	query := `
+		INSERT INTO sessions (user_id, family_id, user_agent, ip, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (family_id) DO UPDATE
+		SET user_agent = EXCLUDED.user_agent, ip = EXCLUDED.ip, last_used_at = NOW(), expires_at = EXCLUDED.expires_at
+	`
+	_, err := tx.Exec(ctx, query, userID, familyID, truncate(client.UserAgent, 512), truncate(client.IP, 64), expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to record session: %w", err)
+	}
+	return nil
+}
+
+func revokeFamily(ctx context.Context, tx pgx.Tx, familyID string) error {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`
+	if _, err := tx.Exec(ctx, query, familyID); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	query = `UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`
+	if _, err := tx.Exec(ctx, query, familyID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
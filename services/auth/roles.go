@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"slices"
+)
+
+const (
+	RoleCustomer = "customer"
+	RoleStaff    = "staff"
+	RoleAdmin    = "admin"
+)
+
+const RolesKey contextKey = "roles"
+
+// RequireRole lets the request through when the authenticated user holds one
+// of roles. Admins pass every role check. It must be wrapped by WithJWTAuth,
+// which puts the roles from the access token into the request context.
+func RequireRole(handlerFunc http.HandlerFunc, roles ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !HasRole(GetRolesFromContext(r.Context()), roles...) {
+			permissionDenied(w)
+			return
+		}
+
+		handlerFunc(w, r)
+	}
+}
+
+// HasRole reports whether granted contains admin or any of roles.
+func HasRole(granted []string, roles ...string) bool {
+	if slices.Contains(granted, RoleAdmin) {
+		return true
+	}
+	for _, role := range roles {
+		if slices.Contains(granted, role) {
+			return true
+		}
+	}
+	return false
+}
+
+func IsValidRole(role string) bool {
+	return role == RoleCustomer || role == RoleStaff || role == RoleAdmin
+}
+
+func GetRolesFromContext(ctx context.Context) []string {
+	roles, _ := ctx.Value(RolesKey).([]string)
+	return roles
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mikeudacha/paybuy/config"
+	"github.com/mikeudacha/paybuy/models"
+	"github.com/mikeudacha/paybuy/utils"
+)
+
+// EmailVerificationTTL is how long a verification link stays valid.
+const EmailVerificationTTL = 24 * time.Hour
+
+var ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+
+type verificationClaims struct {
+	UserID    int    `json:"uid"`
+	Email     string `json:"email"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// CreateEmailVerificationToken signs the user's ID and current email so the
+// link stops working once the email changes.
+func CreateEmailVerificationToken(userID int, email string) (string, error) {
+	payload, err := json.Marshal(verificationClaims{
+		UserID:    userID,
+		Email:     email,
+		ExpiresAt: time.Now().Add(EmailVerificationTTL).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(signVerification(encoded)), nil
+}
+
+// ParseEmailVerificationToken checks the signature and expiry of token and
+// returns the user ID and email it was issued for.
+func ParseEmailVerificationToken(token string) (int, string, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, "", ErrInvalidVerificationToken
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, signVerification(encoded)) {
+		return 0, "", ErrInvalidVerificationToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return 0, "", ErrInvalidVerificationToken
+	}
+
+	var claims verificationClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return 0, "", ErrInvalidVerificationToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return 0, "", ErrInvalidVerificationToken
+	}
+
+	return claims.UserID, claims.Email, nil
+}
+
+// signVerification uses EMAIL_VERIFICATION_SECRET, falling back to the JWT
+// secret when it is not set.
+func signVerification(encoded string) []byte {
+	cfg := config.LoadConfig()
+
+	secret := cfg.EmailVerificationSecret
+	if secret == "" {
+		secret = cfg.JWTSecret
+	}
+
+	mac := hmac.New(sha256.New, []byte("email-verification:"+secret))
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+// RequireVerifiedEmail rejects users who have not confirmed their email
+// address. It must be wrapped by WithJWTAuth.
+func RequireVerifiedEmail(handlerFunc http.HandlerFunc, store models.UserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, err := store.GetUserByID(GetUserIDFromContext(r.Context()))
+		if err != nil {
+			permissionDenied(w)
+			return
+		}
+		if u.EmailVerifiedAt == nil {
+			utils.WriteError(w, http.StatusForbidden, errors.New("email address has not been verified"))
+			return
+		}
+
+		handlerFunc(w, r)
+	}
+}
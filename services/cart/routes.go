@@ -1,39 +1,99 @@
 package cart
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/mikeudacha/paybuy/config"
 	"github.com/mikeudacha/paybuy/models"
+	"github.com/mikeudacha/paybuy/money"
 	"github.com/mikeudacha/paybuy/services/auth"
+	"github.com/mikeudacha/paybuy/services/exchange"
+	"github.com/mikeudacha/paybuy/services/idempotency"
+	"github.com/mikeudacha/paybuy/services/payment"
+	"github.com/mikeudacha/paybuy/services/promotion"
+	"github.com/mikeudacha/paybuy/services/shipping"
+	"github.com/mikeudacha/paybuy/services/tax"
 	"github.com/mikeudacha/paybuy/utils"
 )
 
+var errNotInCart = errors.New("not in the cart")
+
 type Handler struct {
-	productStore   models.ProductStore
-	orderStore     models.OrderStore
-	userStore      models.UserStore
-	blacklistStore *auth.BlacklistStore
+	cartStore          models.CartStore
+	productStore       models.ProductStore
+	orderStore         models.OrderStore
+	couponStore        models.CouponStore
+	addressStore       models.AddressStore
+	inventoryStore     models.InventoryStore
+	userStore          models.UserStore
+	blacklistStore     *auth.BlacklistStore
+	transactor         models.Transactor
+	idempotencyStore   models.IdempotencyStore
+	paymentService     models.PaymentService
+	rates              exchange.RateProvider
+	taxCalculator      tax.TaxCalculator
+	shippingCalculator shipping.RateCalculator
 }
 
 func NewHandler(
+	cartStore models.CartStore,
 	productStore models.ProductStore,
 	orderStore models.OrderStore,
+	couponStore models.CouponStore,
+	addressStore models.AddressStore,
+	inventoryStore models.InventoryStore,
 	userStore models.UserStore,
 	blacklistStore *auth.BlacklistStore,
+	transactor models.Transactor,
+	idempotencyStore models.IdempotencyStore,
+	paymentService models.PaymentService,
+	rates exchange.RateProvider,
+	taxCalculator tax.TaxCalculator,
+	shippingCalculator shipping.RateCalculator,
 ) *Handler {
 	return &Handler{
-		productStore:   productStore,
-		orderStore:     orderStore,
-		userStore:      userStore,
-		blacklistStore: blacklistStore,
+		cartStore:          cartStore,
+		productStore:       productStore,
+		orderStore:         orderStore,
+		couponStore:        couponStore,
+		addressStore:       addressStore,
+		inventoryStore:     inventoryStore,
+		userStore:          userStore,
+		blacklistStore:     blacklistStore,
+		transactor:         transactor,
+		idempotencyStore:   idempotencyStore,
+		paymentService:     paymentService,
+		rates:              rates,
+		taxCalculator:      taxCalculator,
+		shippingCalculator: shippingCalculator,
 	}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
-	router.HandleFunc("/cart/checkout", auth.WithJWTAuth(h.handleCheckout, h.userStore, h.blacklistStore)).Methods(http.MethodPost)
+	checkout := idempotency.WithIdempotency(h.handleCheckout, h.idempotencyStore)
+	checkoutStored := idempotency.WithIdempotency(h.handleCheckoutStoredCart, h.idempotencyStore)
+	// Checked outside the idempotency layer so the rejection is not stored
+	// and the same key works once the email is verified.
+	if requireVerified, _ := strconv.ParseBool(config.LoadConfig().RequireVerifiedEmailCheckout); requireVerified {
+		checkout = auth.RequireVerifiedEmail(checkout, h.userStore)
+		checkoutStored = auth.RequireVerifiedEmail(checkoutStored, h.userStore)
+	}
+
+	router.HandleFunc("/cart/checkout", auth.WithJWTAuth(checkout, h.userStore, h.blacklistStore)).Methods(http.MethodPost)
+	router.HandleFunc("/cart/checkout/stored", auth.WithJWTAuth(checkoutStored, h.userStore, h.blacklistStore)).Methods(http.MethodPost)
+
+	router.HandleFunc("/cart", auth.WithJWTAuth(h.handleGetCart, h.userStore, h.blacklistStore)).Methods(http.MethodGet)
+	router.HandleFunc("/cart", auth.WithJWTAuth(h.handleClearCart, h.userStore, h.blacklistStore)).Methods(http.MethodDelete)
+	router.HandleFunc("/cart/items", auth.WithJWTAuth(idempotency.WithIdempotency(h.handleAddCartItem, h.idempotencyStore), h.userStore, h.blacklistStore)).Methods(http.MethodPost)
+	router.HandleFunc("/cart/items/{productID}", auth.WithJWTAuth(h.handleUpdateCartItem, h.userStore, h.blacklistStore)).Methods(http.MethodPut)
+	router.HandleFunc("/cart/items/{productID}", auth.WithJWTAuth(h.handleRemoveCartItem, h.userStore, h.blacklistStore)).Methods(http.MethodDelete)
 }
 
 func (h *Handler) handleCheckout(w http.ResponseWriter, r *http.Request) {
@@ -51,26 +111,275 @@ func (h *Handler) handleCheckout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	productIds, err := getCartItemsIDs(cart.Items)
-	if err != nil {
+	h.checkout(w, cart.Items, userID, checkoutOptions{
+		currency:       normalizeCurrency(cart.Currency),
+		couponCode:     cart.CouponCode,
+		addressID:      cart.AddressID,
+		address:        cart.Address,
+		shippingMethod: cart.ShippingMethod,
+	})
+}
+
+func (h *Handler) handleCheckoutStoredCart(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	var payload models.StoredCartCheckoutPayload
+	if err := utils.ParseJSON(r, &payload); err != nil && err != io.EOF {
 		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	products, err := h.productStore.GetProductsByID(productIds)
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return
+	}
+
+	cart, err := h.cartStore.GetCartByUserID(userID)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	orderID, totalPrice, err := h.createOrder(products, cart.Items, userID)
+	h.checkout(w, toCheckoutItems(cart.Items), userID, checkoutOptions{
+		currency:        normalizeCurrency(payload.Currency),
+		couponCode:      payload.CouponCode,
+		addressID:       payload.AddressID,
+		address:         payload.Address,
+		shippingMethod:  payload.ShippingMethod,
+		clearStoredCart: true,
+	})
+}
+
+func (h *Handler) checkout(w http.ResponseWriter, items []models.CartCheckoutItem, userID int, opts checkoutOptions) {
+	newOrder, discounts, err := h.createOrder(items, userID, opts)
+	if err != nil {
+		utils.WriteError(w, checkoutErrorStatus(err), err)
+		return
+	}
+
+	orderPayment, err := h.paymentService.StartPayment(*newOrder)
+	if errors.Is(err, payment.ErrPaymentDeclined) {
+		utils.WriteError(w, http.StatusPaymentRequired, err)
+		return
+	}
 	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
 	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
-		"total_price": totalPrice,
-		"order_id":    orderID,
+		"subtotal":        newOrder.Subtotal,
+		"discount_total":  newOrder.DiscountTotal,
+		"discounts":       discounts,
+		"tax_total":       newOrder.TaxTotal,
+		"shipping_method": newOrder.ShippingMethod,
+		"shipping_total":  newOrder.ShippingTotal,
+		"total_price":     newOrder.Total,
+		"order_id":        newOrder.ID,
+		"payment_status":  orderPayment.Status,
 	})
 }
+
+func (h *Handler) handleGetCart(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	currency := normalizeCurrency(r.URL.Query().Get("currency"))
+
+	cart, err := h.cartStore.GetCartByUserID(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.priceCart(cart, currency); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, cart)
+}
+
+func (h *Handler) handleAddCartItem(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	var payload models.AddCartItemPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return
+	}
+
+	h.saveCart(w, r, userID, func(items []models.CartItem) ([]models.CartItem, error) {
+		for i, item := range items {
+			if item.ProductID == payload.ProductID {
+				items[i].Quantity += payload.Quantity
+				return items, nil
+			}
+		}
+
+		return append(items, models.CartItem{
+			ProductID: payload.ProductID,
+			Quantity:  payload.Quantity,
+		}), nil
+	})
+}
+
+func (h *Handler) handleUpdateCartItem(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	productID, err := getProductIDFromRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var payload models.UpdateCartItemPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return
+	}
+
+	h.saveCart(w, r, userID, func(items []models.CartItem) ([]models.CartItem, error) {
+		for i, item := range items {
+			if item.ProductID == productID {
+				items[i].Quantity = payload.Quantity
+				return items, nil
+			}
+		}
+
+		return nil, fmt.Errorf("product %d is %w", productID, errNotInCart)
+	})
+}
+
+func (h *Handler) handleRemoveCartItem(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	productID, err := getProductIDFromRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	h.saveCart(w, r, userID, func(items []models.CartItem) ([]models.CartItem, error) {
+		kept := make([]models.CartItem, 0, len(items))
+		for _, item := range items {
+			if item.ProductID != productID {
+				kept = append(kept, item)
+			}
+		}
+		if len(kept) == len(items) {
+			return nil, fmt.Errorf("product %d is %w", productID, errNotInCart)
+		}
+
+		return kept, nil
+	})
+}
+
+func (h *Handler) handleClearCart(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	if err := h.cartStore.ClearCart(userID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "Cart cleared",
+	})
+}
+
+// saveCart applies change to the items of the user's cart while holding the
+// cart's lock, checks the result against the catalogue and responds with the
+// cart priced in the requested currency.
+func (h *Handler) saveCart(w http.ResponseWriter, r *http.Request, userID int, change func([]models.CartItem) ([]models.CartItem, error)) {
+	currency := normalizeCurrency(r.URL.Query().Get("currency"))
+
+	status := http.StatusInternalServerError
+	err := h.transactor.WithTx(func(tx pgx.Tx) error {
+		cart, err := h.cartStore.GetCartForUpdate(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		items, err := change(cart.Items)
+		if err == nil {
+			items, err = h.refreshCartItems(items)
+		}
+		if err != nil {
+			status = http.StatusBadRequest
+			return err
+		}
+
+		return h.cartStore.SaveCartItemsTx(tx, cart.ID, items)
+	})
+	if errors.Is(err, errNotInCart) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, status, err)
+		return
+	}
+
+	cart, err := h.cartStore.GetCartByUserID(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.priceCart(cart, currency); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, cart)
+}
+
+// checkoutErrorStatus maps a createOrder error to a response status. Only
+// errors caused by the request are client errors; anything else, such as a
+// failed query or commit, is a server error.
+func checkoutErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrEmptyCart),
+		errors.Is(err, ErrInvalidQuantity),
+		errors.Is(err, ErrAddressRequired),
+		errors.Is(err, ErrAddressNotFound):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrUnknownProduct),
+		errors.Is(err, ErrInsufficientStock),
+		errors.Is(err, ErrMixedCurrencies),
+		errors.Is(err, exchange.ErrNoRate),
+		errors.Is(err, money.ErrOutOfRange),
+		errors.Is(err, promotion.ErrCouponNotApplicable),
+		errors.Is(err, shipping.ErrNoShippingMethod):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func getProductIDFromRequest(r *http.Request) (int, error) {
+	vars := mux.Vars(r)
+	str, ok := vars["productID"]
+	if !ok {
+		return 0, fmt.Errorf("missing product ID")
+	}
+
+	productID, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid product ID")
+	}
+
+	return productID, nil
+}
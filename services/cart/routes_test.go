@@ -0,0 +1,29 @@
+package cart
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/mikeudacha/paybuy/services/promotion"
+)
+
+func TestCheckoutErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{err: ErrEmptyCart, want: http.StatusBadRequest},
+		{err: fmt.Errorf("%w: 7", ErrAddressNotFound), want: http.StatusBadRequest},
+		{err: fmt.Errorf("%w: Tea", ErrInsufficientStock), want: http.StatusUnprocessableEntity},
+		{err: fmt.Errorf("%w: coupon X has expired", promotion.ErrCouponNotApplicable), want: http.StatusUnprocessableEntity},
+		{err: errors.New("conn closed"), want: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		if got := checkoutErrorStatus(tt.err); got != tt.want {
+			t.Errorf("checkoutErrorStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
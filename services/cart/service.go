@@ -1,16 +1,41 @@
 package cart
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
+	"strings"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/mikeudacha/paybuy/models"
+	"github.com/mikeudacha/paybuy/money"
+	"github.com/mikeudacha/paybuy/services/address"
+	"github.com/mikeudacha/paybuy/services/exchange"
+	"github.com/mikeudacha/paybuy/services/order"
+	"github.com/mikeudacha/paybuy/services/promotion"
+	"github.com/mikeudacha/paybuy/services/shipping"
+	"github.com/mikeudacha/paybuy/services/tax"
+)
+
+// Errors caused by the cart or checkout request rather than by the server.
+var (
+	ErrEmptyCart         = errors.New("cart is empty")
+	ErrInvalidQuantity   = errors.New("invalid quantity")
+	ErrUnknownProduct    = errors.New("product is not available in the store")
+	ErrInsufficientStock = errors.New("product is not available in the quantity requested")
+	ErrAddressRequired   = errors.New("a shipping address is required")
+	ErrAddressNotFound   = errors.New("address not found")
+
+	// ErrMixedCurrencies is returned when a checkout would need rates from
+	// more than one base currency, which an order cannot record.
+	ErrMixedCurrencies = errors.New("products priced in different currencies need a price in the checkout currency")
 )
 
 func getCartItemsIDs(items []models.CartCheckoutItem) ([]int, error) {
 	productIds := make([]int, len(items))
 	for i, item := range items {
 		if item.Quantity <= 0 {
-			return nil, fmt.Errorf("invalid quantity for product %d", item.ProductID)
+			return nil, fmt.Errorf("%w for product %d", ErrInvalidQuantity, item.ProductID)
 		}
 
 		productIds[i] = item.ProductID
@@ -21,70 +46,438 @@ func getCartItemsIDs(items []models.CartCheckoutItem) ([]int, error) {
 
 func checkIfCartIsInStock(cartItems []models.CartCheckoutItem, products map[int]models.Product) error {
 	if len(cartItems) == 0 {
-		return fmt.Errorf("cart is empty")
+		return ErrEmptyCart
 	}
 
+	requested := make(map[int]int)
 	for _, item := range cartItems {
 		product, ok := products[item.ProductID]
 		if !ok {
-			return fmt.Errorf("product %d is not available in the store, please refresh your cart", item.ProductID)
+			return fmt.Errorf("%w: product %d, please refresh your cart", ErrUnknownProduct, item.ProductID)
 		}
 
-		if product.Quantity < item.Quantity {
-			return fmt.Errorf("product %s is not available in the quantity requested", product.Name)
+		requested[item.ProductID] += item.Quantity
+		if product.Available < requested[item.ProductID] {
+			return fmt.Errorf("%w: %s", ErrInsufficientStock, product.Name)
 		}
 	}
 
 	return nil
 }
 
-func calculateTotalPrice(cartItems []models.CartCheckoutItem, products map[int]models.Product) float64 {
-	var total float64
+func calculateTotalPrice(cartItems []models.CartCheckoutItem, unitPrices map[int]money.Money, currency string) money.Money {
+	total := money.Zero(currency)
 
 	for _, item := range cartItems {
-		product := products[item.ProductID]
-		total += product.Price * float64(item.Quantity)
+		total = total.Add(unitPrices[item.ProductID].Mul(item.Quantity))
 	}
 
 	return total
 }
 
-func (h *Handler) createOrder(products []models.Product, cartItems []models.CartCheckoutItem, userID int) (int, float64, error) {
+func normalizeCurrency(currency string) string {
+	if currency == "" {
+		return money.DefaultCurrency
+	}
+	return strings.ToUpper(currency)
+}
+
+// listPrice returns the product's price in currency when it does not have to
+// be converted: the base price or a price-list entry.
+func listPrice(product models.Product, currency string) (money.Money, bool) {
+	if product.Price.Currency == currency {
+		return product.Price, true
+	}
+
+	for _, price := range product.Prices {
+		if price.Currency == currency {
+			return price, true
+		}
+	}
+
+	return money.Money{}, false
+}
+
+// priceIn returns the product's unit price in currency: its list price when
+// one exists, otherwise the base price converted at the current rate.
+func (h *Handler) priceIn(product models.Product, currency string) (money.Money, error) {
+	if price, ok := listPrice(product, currency); ok {
+		return price, nil
+	}
+
+	return exchange.Convert(h.rates, product.Price, currency)
+}
+
+// orderRate returns the exchange rate an order in currency is priced at: the
+// rate from the base currency of the products that are converted, or 1 when
+// every product has a list price in currency.
+func (h *Handler) orderRate(products map[int]models.Product, currency string) (*big.Rat, error) {
+	base := ""
+	for _, product := range products {
+		if _, ok := listPrice(product, currency); ok {
+			continue
+		}
+		if base != "" && base != product.Price.Currency {
+			return nil, ErrMixedCurrencies
+		}
+		base = product.Price.Currency
+	}
+
+	if base == "" {
+		return big.NewRat(1, 1), nil
+	}
+	return h.rates.Rate(base, currency)
+}
+
+func (h *Handler) unitPrices(products map[int]models.Product, currency string) (map[int]money.Money, error) {
+	prices := make(map[int]money.Money, len(products))
+	for id, product := range products {
+		price, err := h.priceIn(product, currency)
+		if err != nil {
+			return nil, err
+		}
+		prices[id] = price
+	}
+
+	return prices, nil
+}
+
+// refreshCartItems checks every stored line against the current catalogue,
+// rejecting unknown products or quantities above stock and updating unit
+// prices to the current product price.
+func (h *Handler) refreshCartItems(items []models.CartItem) ([]models.CartItem, error) {
+	if len(items) == 0 {
+		return items, nil
+	}
+
+	productIDs := make([]int, len(items))
+	for i, item := range items {
+		productIDs[i] = item.ProductID
+	}
+
+	products, err := h.productStore.GetProductsByID(productIDs)
+	if err != nil {
+		return nil, err
+	}
+
 	productsMap := make(map[int]models.Product)
 	for _, product := range products {
 		productsMap[product.ID] = product
 	}
 
-	if err := checkIfCartIsInStock(cartItems, productsMap); err != nil {
-		return 0, 0, err
+	for i, item := range items {
+		product, ok := productsMap[item.ProductID]
+		if !ok {
+			return nil, fmt.Errorf("%w: product %d", ErrUnknownProduct, item.ProductID)
+		}
+
+		if product.Available < item.Quantity {
+			return nil, fmt.Errorf("%w: %s", ErrInsufficientStock, product.Name)
+		}
+
+		items[i].UnitPrice = product.Price
 	}
 
-	totalPrice := calculateTotalPrice(cartItems, productsMap)
+	return items, nil
+}
 
-	for _, item := range cartItems {
-		product := productsMap[item.ProductID]
-		product.Quantity -= item.Quantity
-		h.productStore.UpdateProduct(product)
+// priceCart fills in unit prices and the total of a stored cart in currency,
+// using current catalogue prices.
+func (h *Handler) priceCart(cart *models.Cart, currency string) error {
+	productIDs := make([]int, len(cart.Items))
+	for i, item := range cart.Items {
+		productIDs[i] = item.ProductID
 	}
 
-	orderID, err := h.orderStore.CreateOrder(models.Order{
-		UserID:  userID,
-		Total:   totalPrice,
-		Status:  "status",
-		Address: "address",
-	})
+	products, err := h.productStore.GetProductsByID(productIDs)
 	if err != nil {
-		return 0, 0, err
+		return err
 	}
 
-	for _, item := range cartItems {
-		h.orderStore.CreateOrderItem(models.OrderItem{
-			OrderID:   orderID,
+	productsMap := make(map[int]models.Product)
+	for _, product := range products {
+		productsMap[product.ID] = product
+	}
+
+	total := money.Zero(currency)
+	for i, item := range cart.Items {
+		var price money.Money
+		if product, ok := productsMap[item.ProductID]; ok {
+			price, err = h.priceIn(product, currency)
+		} else {
+			price, err = exchange.Convert(h.rates, item.UnitPrice, currency)
+		}
+		if err != nil {
+			return err
+		}
+
+		cart.Items[i].UnitPrice = price
+		total = total.Add(price.Mul(item.Quantity))
+	}
+	cart.Total = total
+
+	return nil
+}
+
+func toCheckoutItems(items []models.CartItem) []models.CartCheckoutItem {
+	checkoutItems := make([]models.CartCheckoutItem, len(items))
+	for i, item := range items {
+		checkoutItems[i] = models.CartCheckoutItem{
 			ProductID: item.ProductID,
 			Quantity:  item.Quantity,
-			Price:     productsMap[item.ProductID].Price,
-		})
+		}
+	}
+
+	return checkoutItems
+}
+
+// allocateDiscount spreads discount over lines in proportion to their
+// amounts. The last line takes the rounding remainder so the shares add up to
+// discount exactly.
+func allocateDiscount(lines []money.Money, discount money.Money) []money.Money {
+	shares := make([]money.Money, len(lines))
+	subtotal := money.Zero(discount.Currency)
+	for _, line := range lines {
+		subtotal = subtotal.Add(line)
+	}
+
+	remaining := discount
+	for i, line := range lines {
+		if i == len(lines)-1 || subtotal.IsZero() {
+			shares[i] = remaining
+			remaining = money.Zero(discount.Currency)
+			continue
+		}
+		shares[i] = discount.MulRat(big.NewRat(line.Amount, subtotal.Amount))
+		remaining = remaining.Sub(shares[i])
+	}
+
+	return shares
+}
+
+// checkoutOptions carries the per-request settings of a checkout.
+type checkoutOptions struct {
+	currency        string
+	couponCode      string
+	addressID       *int
+	address         *models.ShippingAddress
+	shippingMethod  string
+	clearStoredCart bool
+}
+
+// shippingAddress resolves the checkout address: a saved address of the
+// user, the inline address, or else the user's default address.
+func (h *Handler) shippingAddress(userID int, opts checkoutOptions) (*models.ShippingAddress, error) {
+	if opts.addressID != nil {
+		saved, err := h.addressStore.GetAddressByID(*opts.addressID)
+		if err != nil {
+			return nil, err
+		}
+		if saved == nil || saved.UserID != userID {
+			return nil, fmt.Errorf("%w: %d", ErrAddressNotFound, *opts.addressID)
+		}
+		return &saved.ShippingAddress, nil
+	}
+
+	if opts.address != nil {
+		a := *opts.address
+		a.Country = strings.ToUpper(a.Country)
+		a.Region = strings.ToUpper(a.Region)
+		return &a, nil
+	}
+
+	addresses, err := h.addressStore.GetAddressesByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, saved := range addresses {
+		if saved.IsDefault {
+			return &saved.ShippingAddress, nil
+		}
+	}
+
+	return nil, ErrAddressRequired
+}
+
+// createOrder reserves stock, applies the coupon, prices shipping, calculates
+// tax on the discounted lines and creates the order and all
+// of its items inside a single transaction, so a failure at any step leaves
+// the database untouched.
+func (h *Handler) createOrder(cartItems []models.CartCheckoutItem, userID int, opts checkoutOptions) (*models.Order, []models.OrderDiscount, error) {
+	productIDs, err := getCartItemsIDs(cartItems)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	shipTo, err := h.shippingAddress(userID, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	destination := tax.Destination{Country: shipTo.Country, Region: shipTo.Region}
+
+	newOrder := &models.Order{
+		UserID:          userID,
+		Status:          order.StatusPending,
+		Address:         address.Format(*shipTo),
+		ShippingAddress: shipTo,
+		TaxCountry:      destination.Country,
+		TaxRegion:       destination.Region,
+	}
+	discounts := make([]models.OrderDiscount, 0)
+
+	err = h.transactor.WithTx(func(tx pgx.Tx) error {
+		products, err := h.productStore.GetProductsByIDForUpdate(tx, productIDs)
+		if err != nil {
+			return err
+		}
+
+		// Read reservations only once the product rows are locked, so a
+		// concurrent checkout's reservations are already visible.
+		reserved, err := h.inventoryStore.GetReservedQuantitiesTx(tx, productIDs)
+		if err != nil {
+			return err
+		}
+
+		productsMap := make(map[int]models.Product)
+		for _, product := range products {
+			product.Available = product.Quantity - reserved[product.ID]
+			productsMap[product.ID] = product
+		}
+
+		if err := checkIfCartIsInStock(cartItems, productsMap); err != nil {
+			return err
+		}
+
+		rate, err := h.orderRate(productsMap, opts.currency)
+		if err != nil {
+			return err
+		}
+		newOrder.ExchangeRate = exchange.FormatRate(rate)
+
+		unitPrices, err := h.unitPrices(productsMap, opts.currency)
+		if err != nil {
+			return err
+		}
+
+		newOrder.Subtotal = calculateTotalPrice(cartItems, unitPrices, opts.currency)
+		newOrder.DiscountTotal = money.Zero(opts.currency)
+
+		var coupon *models.Coupon
+		if opts.couponCode != "" {
+			lines := make([]promotion.Line, len(cartItems))
+			for i, item := range cartItems {
+				lines[i] = promotion.Line{
+					ProductID: item.ProductID,
+					Quantity:  item.Quantity,
+					UnitPrice: unitPrices[item.ProductID],
+				}
+			}
+
+			var discount *models.OrderDiscount
+			coupon, discount, err = promotion.Prepare(tx, h.couponStore, opts.couponCode, userID, lines, newOrder.Subtotal, h.rates)
+			if err != nil {
+				return err
+			}
+			discounts = append(discounts, *discount)
+			newOrder.DiscountTotal = newOrder.DiscountTotal.Add(discount.Amount)
+		}
+
+		weight := 0
+		for _, item := range cartItems {
+			weight += productsMap[item.ProductID].WeightGrams * item.Quantity
+		}
+		options, err := h.shippingCalculator.Quote(shipTo.Country, weight, newOrder.Subtotal.Sub(newOrder.DiscountTotal))
+		if err != nil {
+			return err
+		}
+		option, err := shipping.Select(options, opts.shippingMethod)
+		if err != nil {
+			return err
+		}
+
+		newOrder.ShippingMethod = option.Method
+		newOrder.ShippingTotal = option.Price
+		for _, discount := range discounts {
+			if discount.FreeShipping {
+				newOrder.ShippingTotal = money.Zero(opts.currency)
+			}
+		}
+
+		lineAmounts := make([]money.Money, len(cartItems))
+		for i, item := range cartItems {
+			lineAmounts[i] = unitPrices[item.ProductID].Mul(item.Quantity)
+		}
+		lineDiscounts := allocateDiscount(lineAmounts, newOrder.DiscountTotal)
+
+		taxLines := make([]tax.Line, len(cartItems))
+		for i, item := range cartItems {
+			taxLines[i] = tax.Line{
+				ProductID:   item.ProductID,
+				TaxCategory: productsMap[item.ProductID].TaxCategory,
+				Amount:      lineAmounts[i].Sub(lineDiscounts[i]),
+			}
+		}
+		taxes, err := h.taxCalculator.Calculate(destination, taxLines)
+		if err != nil {
+			return err
+		}
+
+		newOrder.TaxTotal = money.Zero(opts.currency)
+		for _, lineTax := range taxes {
+			newOrder.TaxTotal = newOrder.TaxTotal.Add(lineTax.Amount)
+		}
+
+		newOrder.Total = newOrder.Subtotal.Sub(newOrder.DiscountTotal).Add(newOrder.TaxTotal).Add(newOrder.ShippingTotal)
+
+		newOrder.ID, err = h.orderStore.CreateOrderTx(tx, *newOrder)
+		if err != nil {
+			return err
+		}
+
+		for i, item := range cartItems {
+			product := productsMap[item.ProductID]
+			err := h.orderStore.CreateOrderItemTx(tx, models.OrderItem{
+				OrderID:      newOrder.ID,
+				ProductID:    item.ProductID,
+				ProductName:  product.Name,
+				ProductImage: product.Image,
+				Quantity:     item.Quantity,
+				Price:        unitPrices[item.ProductID],
+				TaxCategory:  taxes[i].TaxCategory,
+				TaxRate:      tax.FormatRate(taxes[i].Rate),
+				Tax:          taxes[i].Amount,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := h.inventoryStore.ReserveTx(tx, newOrder.ID, cartItems); err != nil {
+			return err
+		}
+
+		if coupon != nil {
+			if err := h.couponStore.RedeemCouponTx(tx, coupon.ID, userID, newOrder.ID); err != nil {
+				return err
+			}
+		}
+
+		for i := range discounts {
+			discounts[i].OrderID = newOrder.ID
+			if err := h.orderStore.CreateOrderDiscountTx(tx, discounts[i]); err != nil {
+				return err
+			}
+		}
+
+		if opts.clearStoredCart {
+			return h.cartStore.ClearCartTx(tx, userID)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return orderID, totalPrice, nil
+	return newOrder, discounts, nil
 }
@@ -0,0 +1,139 @@
+package cart
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mikeudacha/paybuy/db"
+	"github.com/mikeudacha/paybuy/models"
+)
+
+type Store struct {
+	pool *pgxpool.Pool
+}
+
+func NewStore(pool *pgxpool.Pool) *Store {
+	return &Store{pool: pool}
+}
+
+// GetCartByUserID returns the user's stored cart. A user that has never added
+// anything gets an empty cart with a zero ID.
+func (s *Store) GetCartByUserID(userID int) (*models.Cart, error) {
+	cart := &models.Cart{UserID: userID, Items: []models.CartItem{}}
+
+	query := `SELECT id, created_at, updated_at FROM carts WHERE user_id = $1`
+	err := s.pool.QueryRow(context.Background(), query, userID).Scan(&cart.ID, &cart.CreatedAt, &cart.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return cart, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	query = `SELECT id, cart_id, product_id, quantity, unit_price, currency, created_at FROM cart_items WHERE cart_id = $1 ORDER BY id`
+	rows, err := s.pool.Query(context.Background(), query, cart.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scanRowsIntoCartItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		cart.Items = append(cart.Items, *item)
+	}
+
+	return cart, rows.Err()
+}
+
+// GetCartForUpdate returns the user's cart with its row locked until tx ends,
+// creating the cart on first use. Changes to a cart go through this lock so
+// concurrent requests apply one after the other instead of overwriting each
+// other.
+func (s *Store) GetCartForUpdate(tx pgx.Tx, userID int) (*models.Cart, error) {
+	ctx := context.Background()
+	cart := &models.Cart{UserID: userID, Items: []models.CartItem{}}
+
+	query := `
+		INSERT INTO carts (user_id) VALUES ($1)
+		ON CONFLICT (user_id) DO UPDATE SET updated_at = CURRENT_TIMESTAMP
+		RETURNING id, created_at, updated_at
+	`
+	if err := tx.QueryRow(ctx, query, userID).Scan(&cart.ID, &cart.CreatedAt, &cart.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	query = `SELECT id, cart_id, product_id, quantity, unit_price, currency, created_at FROM cart_items WHERE cart_id = $1 ORDER BY id`
+	rows, err := tx.Query(ctx, query, cart.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scanRowsIntoCartItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		cart.Items = append(cart.Items, *item)
+	}
+
+	return cart, rows.Err()
+}
+
+// SaveCartItemsTx replaces the contents of cart cartID with items. The cart
+// must have been locked with GetCartForUpdate in the same transaction.
+func (s *Store) SaveCartItemsTx(tx pgx.Tx, cartID int, items []models.CartItem) error {
+	ctx := context.Background()
+
+	if _, err := tx.Exec(ctx, `DELETE FROM cart_items WHERE cart_id = $1`, cartID); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO cart_items (cart_id, product_id, quantity, unit_price, currency) VALUES ($1, $2, $3, $4, $5)`
+	for _, item := range items {
+		if _, err := tx.Exec(ctx, query, cartID, item.ProductID, item.Quantity, item.UnitPrice, item.UnitPrice.Currency); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) ClearCart(userID int) error {
+	return clearCart(s.pool, userID)
+}
+
+func (s *Store) ClearCartTx(tx pgx.Tx, userID int) error {
+	return clearCart(tx, userID)
+}
+
+func clearCart(q db.Querier, userID int) error {
+	query := `DELETE FROM cart_items WHERE cart_id = (SELECT id FROM carts WHERE user_id = $1)`
+	_, err := q.Exec(context.Background(), query, userID)
+	return err
+}
+
+func scanRowsIntoCartItem(rows pgx.Rows) (*models.CartItem, error) {
+	item := new(models.CartItem)
+
+	var currency string
+	err := rows.Scan(
+		&item.ID,
+		&item.CartID,
+		&item.ProductID,
+		&item.Quantity,
+		&item.UnitPrice,
+		&currency,
+		&item.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	item.UnitPrice = item.UnitPrice.WithCurrency(currency)
+
+	return item, nil
+}
@@ -0,0 +1,108 @@
+package exchange
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/mikeudacha/paybuy/money"
+)
+
+// RateDecimals is the precision exchange rates are stored with on orders.
+const RateDecimals = 8
+
+type RateProvider interface {
+	// Rate returns how many units of to one unit of from is worth.
+	Rate(from, to string) (*big.Rat, error)
+}
+
+// StaticRateProvider serves fixed rates relative to a base currency. It is
+// loaded from a JSON file of the form
+//
+//	{"base": "USD", "rates": {"EUR": "0.92", "GBP": "0.79"}}
+type StaticRateProvider struct {
+	base  string
+	rates map[string]*big.Rat
+}
+
+type rateFile struct {
+	Base  string            `json:"base"`
+	Rates map[string]string `json:"rates"`
+}
+
+func NewStaticRateProvider(base string, rates map[string]*big.Rat) *StaticRateProvider {
+	p := &StaticRateProvider{
+		base:  strings.ToUpper(base),
+		rates: make(map[string]*big.Rat, len(rates)+1),
+	}
+	for currency, rate := range rates {
+		p.rates[strings.ToUpper(currency)] = rate
+	}
+	p.rates[p.base] = big.NewRat(1, 1)
+	return p
+}
+
+func NewStaticRateProviderFromFile(path string) (*StaticRateProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exchange rates: %w", err)
+	}
+
+	var f rateFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse exchange rates: %w", err)
+	}
+	if f.Base == "" {
+		return nil, fmt.Errorf("exchange rates file is missing a base currency")
+	}
+
+	rates := make(map[string]*big.Rat, len(f.Rates))
+	for currency, value := range f.Rates {
+		rate, ok := new(big.Rat).SetString(value)
+		if !ok || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid exchange rate for %s: %q", currency, value)
+		}
+		rates[currency] = rate
+	}
+
+	return NewStaticRateProvider(f.Base, rates), nil
+}
+
+// ErrNoRate is returned for a currency the provider has no rate for.
+var ErrNoRate = errors.New("no exchange rate")
+
+func (p *StaticRateProvider) Rate(from, to string) (*big.Rat, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == to {
+		return big.NewRat(1, 1), nil
+	}
+
+	fromRate, ok := p.rates[from]
+	if !ok {
+		return nil, fmt.Errorf("%w for %s", ErrNoRate, from)
+	}
+	toRate, ok := p.rates[to]
+	if !ok {
+		return nil, fmt.Errorf("%w for %s", ErrNoRate, to)
+	}
+
+	return new(big.Rat).Quo(toRate, fromRate), nil
+}
+
+// Convert expresses m in the currency to using the provider's rate.
+func Convert(p RateProvider, m money.Money, to string) (money.Money, error) {
+	rate, err := p.Rate(m.Currency, to)
+	if err != nil {
+		return money.Money{}, err
+	}
+
+	return money.FromMajor(new(big.Rat).Mul(m.Major(), rate), to)
+}
+
+// FormatRate renders a rate with RateDecimals places for storage.
+func FormatRate(rate *big.Rat) string {
+	return rate.FloatString(RateDecimals)
+}
@@ -0,0 +1,145 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/mikeudacha/paybuy/models"
+	"github.com/mikeudacha/paybuy/services/auth"
+	"github.com/mikeudacha/paybuy/utils"
+)
+
+const (
+	HeaderKey         = "Idempotency-Key"
+	HeaderReplayed    = "Idempotent-Replayed"
+	KeyTTL            = 24 * time.Hour
+	maxKeyLength      = 255
+	maxRequestBodyLen = 1 << 20
+)
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// WithIdempotency makes a handler safe to retry. Requests carrying an
+// Idempotency-Key header are stored together with their response; a retry
+// with the same key and body replays the stored response, while a retry with
+// a different body is rejected. It must be wrapped by auth.WithJWTAuth since
+// keys are scoped to the authenticated user.
+func WithIdempotency(handlerFunc http.HandlerFunc, store models.IdempotencyStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(HeaderKey)
+		if key == "" {
+			handlerFunc(w, r)
+			return
+		}
+
+		if len(key) > maxKeyLength {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("idempotency key must be at most %d characters", maxKeyLength))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodyLen))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("request body must be at most %d bytes", maxRequestBodyLen))
+			return
+		}
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to read request body"))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		record, created, err := store.Reserve(models.IdempotencyRecord{
+			UserID:      auth.GetUserIDFromContext(r.Context()),
+			Key:         key,
+			Method:      r.Method,
+			Path:        r.URL.Path,
+			RequestHash: hashRequest(r.Method, r.URL.Path, body),
+			ExpiresAt:   time.Now().Add(KeyTTL),
+		})
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		if !created {
+			replay(w, r, record, body)
+			return
+		}
+
+		// A panicking handler never produces a response to store, so the key
+		// is released before the panic continues up to the server.
+		defer func() {
+			if p := recover(); p != nil {
+				if err := store.Delete(record.ID); err != nil {
+					log.Printf("idempotency: %v", err)
+				}
+				panic(p)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		handlerFunc(recorder, r)
+
+		// Server errors are not final, so the key is released and the client
+		// may retry the same request.
+		if recorder.status >= http.StatusInternalServerError {
+			if err := store.Delete(record.ID); err != nil {
+				log.Printf("idempotency: %v", err)
+			}
+			return
+		}
+
+		if err := store.SaveResponse(record.ID, recorder.status, recorder.body.Bytes()); err != nil {
+			log.Printf("idempotency: %v", err)
+		}
+	}
+}
+
+func replay(w http.ResponseWriter, r *http.Request, record *models.IdempotencyRecord, body []byte) {
+	if record.RequestHash != hashRequest(r.Method, r.URL.Path, body) {
+		utils.WriteError(w, http.StatusUnprocessableEntity, fmt.Errorf("idempotency key was already used with a different request"))
+		return
+	}
+
+	if record.ResponseStatus == nil {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("a request with this idempotency key is still being processed"))
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Set(HeaderReplayed, "true")
+	w.WriteHeader(*record.ResponseStatus)
+	w.Write(record.ResponseBody)
+}
+
+func hashRequest(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
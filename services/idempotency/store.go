@@ -0,0 +1,149 @@
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mikeudacha/paybuy/models"
+)
+
+type Store struct {
+	pool *pgxpool.Pool
+}
+
+func NewStore(pool *pgxpool.Pool) *Store {
+	return &Store{pool: pool}
+}
+
+// Reserve claims the key for the given user. It returns the stored record and
+// true when the key is new (or its previous use has expired), or the existing
+// record and false when the key has already been used.
+func (s *Store) Reserve(record models.IdempotencyRecord) (*models.IdempotencyRecord, bool, error) {
+	query := `
+		INSERT INTO idempotency_keys (user_id, key, method, path, request_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, key) DO UPDATE SET
+			method = EXCLUDED.method,
+			path = EXCLUDED.path,
+			request_hash = EXCLUDED.request_hash,
+			response_status = NULL,
+			response_body = NULL,
+			expires_at = EXCLUDED.expires_at,
+			created_at = CURRENT_TIMESTAMP
+		WHERE idempotency_keys.expires_at <= NOW()
+		RETURNING id, user_id, key, method, path, request_hash, response_status, response_body, expires_at, created_at
+	`
+
+	rows, err := s.pool.Query(context.Background(), query,
+		record.UserID,
+		record.Key,
+		record.Method,
+		record.Path,
+		record.RequestHash,
+		record.ExpiresAt,
+	)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		r, err := scanRowsIntoRecord(rows)
+		if err != nil {
+			return nil, false, err
+		}
+		return r, true, nil
+	}
+	rows.Close()
+
+	existing, err := s.getRecord(record.UserID, record.Key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return existing, false, nil
+}
+
+func (s *Store) SaveResponse(id int, status int, body []byte) error {
+	query := `UPDATE idempotency_keys SET response_status = $1, response_body = $2 WHERE id = $3`
+
+	_, err := s.pool.Exec(context.Background(), query, status, body, id)
+	if err != nil {
+		return fmt.Errorf("failed to save idempotent response: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) Delete(id int) error {
+	_, err := s.pool.Exec(context.Background(), `DELETE FROM idempotency_keys WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) CleanupExpiredKeys() error {
+	_, err := s.pool.Exec(context.Background(), `DELETE FROM idempotency_keys WHERE expires_at <= NOW()`)
+	if err != nil {
+		return fmt.Errorf("failed to cleanup expired idempotency keys: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) CleanupExpiredKeysPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			if err := s.CleanupExpiredKeys(); err != nil {
+				fmt.Printf("Failed to cleanup expired idempotency keys: %v\n", err)
+			}
+		}
+	}()
+}
+
+func (s *Store) getRecord(userID int, key string) (*models.IdempotencyRecord, error) {
+	query := `
+		SELECT id, user_id, key, method, path, request_hash, response_status, response_body, expires_at, created_at
+		FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2
+	`
+	rows, err := s.pool.Query(context.Background(), query, userID, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, fmt.Errorf("idempotency key not found")
+	}
+
+	return scanRowsIntoRecord(rows)
+}
+
+func scanRowsIntoRecord(rows pgx.Rows) (*models.IdempotencyRecord, error) {
+	record := new(models.IdempotencyRecord)
+
+	err := rows.Scan(
+		&record.ID,
+		&record.UserID,
+		&record.Key,
+		&record.Method,
+		&record.Path,
+		&record.RequestHash,
+		&record.ResponseStatus,
+		&record.ResponseBody,
+		&record.ExpiresAt,
+		&record.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
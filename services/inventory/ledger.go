@@ -0,0 +1,109 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mikeudacha/paybuy/models"
+)
+
+func (s *Store) MoveStockTx(tx pgx.Tx, movement models.StockMovement) (*models.StockMovement, error) {
+	if movement.Delta == 0 {
+		return nil, fmt.Errorf("stock movement must change the quantity")
+	}
+
+	ctx := context.Background()
+
+	query := `UPDATE products SET quantity = quantity + $1 WHERE id = $2 RETURNING quantity`
+	err := tx.QueryRow(ctx, query, movement.Delta, movement.ProductID).Scan(&movement.QuantityAfter)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("product %d not found", movement.ProductID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if movement.QuantityAfter < 0 {
+		return nil, fmt.Errorf("%w: product %d would drop to %d", ErrInsufficientStock, movement.ProductID, movement.QuantityAfter)
+	}
+
+	query = `
+		INSERT INTO stock_movements (product_id, delta, quantity_after, reason, actor_id, reference, note)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+	err = tx.QueryRow(ctx, query,
+		movement.ProductID,
+		movement.Delta,
+		movement.QuantityAfter,
+		movement.Reason,
+		movement.ActorID,
+		movement.Reference,
+		movement.Note,
+	).Scan(&movement.ID, &movement.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &movement, nil
+}
+
+func (s *Store) MoveStock(movement models.StockMovement) (*models.StockMovement, error) {
+	ctx := context.Background()
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	recorded, err := s.MoveStockTx(tx, movement)
+	if err != nil {
+		return nil, err
+	}
+
+	return recorded, tx.Commit(ctx)
+}
+
+func (s *Store) GetStockMovements(productID int) ([]models.StockMovement, error) {
+	query := `
+		SELECT id, product_id, delta, quantity_after, reason, actor_id, reference, note, created_at
+		FROM stock_movements
+		WHERE product_id = $1
+		ORDER BY id
+	`
+	rows, err := s.pool.Query(context.Background(), query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movements := make([]models.StockMovement, 0)
+	for rows.Next() {
+		var m models.StockMovement
+		err := rows.Scan(
+			&m.ID,
+			&m.ProductID,
+			&m.Delta,
+			&m.QuantityAfter,
+			&m.Reason,
+			&m.ActorID,
+			&m.Reference,
+			&m.Note,
+			&m.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		movements = append(movements, m)
+	}
+
+	return movements, rows.Err()
+}
+
+func (s *Store) GetLedgerQuantity(productID int) (int, error) {
+	var quantity int
+	query := `SELECT COALESCE(SUM(delta), 0) FROM stock_movements WHERE product_id = $1`
+	err := s.pool.QueryRow(context.Background(), query, productID).Scan(&quantity)
+	return quantity, err
+}
@@ -0,0 +1,223 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mikeudacha/paybuy/models"
+	"github.com/mikeudacha/paybuy/services/order"
+)
+
+const (
+	ReservationActive    = "active"
+	ReservationConverted = "converted"
+	ReservationReleased  = "released"
+)
+
+// Stock movement reasons recorded in the ledger.
+const (
+	ReasonInitial      = "initial"
+	ReasonCheckout     = "checkout"
+	ReasonCancellation = "cancellation"
+	ReasonAdjustment   = "adjustment"
+	ReasonImport       = "import"
+	ReasonReturn       = "return"
+)
+
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// DefaultReservationTTL is how long checkout holds stock for an unpaid order.
+const DefaultReservationTTL = 15 * time.Minute
+
+// paymentHoldFactor scales the reservation TTL into the time an order with a
+// payment in flight keeps its expired reservations.
+const paymentHoldFactor = 2
+
+type Store struct {
+	pool *pgxpool.Pool
+	ttl  time.Duration
+}
+
+func NewStore(pool *pgxpool.Pool, ttl time.Duration) *Store {
+	if ttl <= 0 {
+		ttl = DefaultReservationTTL
+	}
+	return &Store{pool: pool, ttl: ttl}
+}
+
+func (s *Store) GetReservedQuantitiesTx(tx pgx.Tx, productIDs []int) (map[int]int, error) {
+	reserved := make(map[int]int)
+
+	query := `
+		SELECT product_id, SUM(quantity)
+		FROM stock_reservations
+		WHERE product_id = ANY($1) AND status = 'active'
+		GROUP BY product_id
+	`
+	rows, err := tx.Query(context.Background(), query, productIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID, quantity int
+		if err := rows.Scan(&productID, &quantity); err != nil {
+			return nil, err
+		}
+		reserved[productID] = quantity
+	}
+
+	return reserved, rows.Err()
+}
+
+func (s *Store) ReserveTx(tx pgx.Tx, orderID int, items []models.CartCheckoutItem) error {
+	expiresAt := time.Now().Add(s.ttl)
+
+	query := `INSERT INTO stock_reservations (order_id, product_id, quantity, expires_at) VALUES ($1, $2, $3, $4)`
+	for _, item := range items {
+		if _, err := tx.Exec(context.Background(), query, orderID, item.ProductID, item.Quantity, expiresAt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) ConvertReservationsTx(tx pgx.Tx, orderID int, actorID *int) error {
+	err := s.moveReservedStock(tx, orderID, ReservationActive, -1, ReasonCheckout, actorID)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE stock_reservations SET status = 'converted', updated_at = CURRENT_TIMESTAMP WHERE order_id = $1 AND status = 'active'`
+	_, err = tx.Exec(context.Background(), query, orderID)
+	return err
+}
+
+func (s *Store) ReleaseReservationsTx(tx pgx.Tx, orderID int, actorID *int) error {
+	err := s.moveReservedStock(tx, orderID, ReservationConverted, 1, ReasonCancellation, actorID)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE stock_reservations SET status = 'released', updated_at = CURRENT_TIMESTAMP WHERE order_id = $1 AND status IN ('active', 'converted')`
+	_, err = tx.Exec(context.Background(), query, orderID)
+	return err
+}
+
+// moveReservedStock records one ledger movement per product for the order's
+// reservations in status, moving sign times the reserved quantity.
+func (s *Store) moveReservedStock(tx pgx.Tx, orderID int, status string, sign int, reason string, actorID *int) error {
+	query := `
+		SELECT product_id, SUM(quantity)
+		FROM stock_reservations
+		WHERE order_id = $1 AND status = $2
+		GROUP BY product_id
+		ORDER BY product_id
+	`
+	rows, err := tx.Query(context.Background(), query, orderID, status)
+	if err != nil {
+		return err
+	}
+
+	quantities := make(map[int]int)
+	productIDs := make([]int, 0)
+	for rows.Next() {
+		var productID, quantity int
+		if err := rows.Scan(&productID, &quantity); err != nil {
+			rows.Close()
+			return err
+		}
+		quantities[productID] = quantity
+		productIDs = append(productIDs, productID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, productID := range productIDs {
+		_, err := s.MoveStockTx(tx, models.StockMovement{
+			ProductID: productID,
+			Delta:     sign * quantities[productID],
+			Reason:    reason,
+			ActorID:   actorID,
+			Reference: fmt.Sprintf("order:%d", orderID),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReleaseExpiredReservations cancels every pending order whose reservations
+// have expired. Cancelling goes through the order state machine, which
+// releases the reservations and records the reason in the status history.
+// Orders whose payment is still pending or authorized are given until
+// paymentHold after the payment's last update for the gateway to settle it;
+// after that the payment is treated as stuck and the order is cancelled too.
+// A capture that arrives later is refunded by the payment webhook. A failure
+// on one order is logged and the rest are still processed.
+func (s *Store) ReleaseExpiredReservations(orders models.OrderStore) error {
+	paymentHold := paymentHoldFactor * s.ttl
+
+	query := `
+		SELECT DISTINCT r.order_id FROM stock_reservations r
+		WHERE r.status = 'active' AND r.expires_at <= CURRENT_TIMESTAMP
+		AND NOT EXISTS (
+			SELECT 1 FROM payments p
+			WHERE p.order_id = r.order_id AND p.status IN ('pending', 'authorized')
+			AND p.updated_at > CURRENT_TIMESTAMP - $1 * INTERVAL '1 second'
+		)
+	`
+	rows, err := s.pool.Query(context.Background(), query, int64(paymentHold.Seconds()))
+	if err != nil {
+		return err
+	}
+
+	orderIDs := make([]int, 0)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		orderIDs = append(orderIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range orderIDs {
+		_, err := orders.TransitionStatus(id, order.StatusCancelled, nil, "stock reservation expired")
+		if errors.Is(err, order.ErrInvalidTransition) {
+			// The order was paid or cancelled in the meantime.
+			continue
+		}
+		if err != nil {
+			log.Printf("inventory: failed to release reservations of order %d: %v", id, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) ReleaseExpiredReservationsPeriodically(orders models.OrderStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			if err := s.ReleaseExpiredReservations(orders); err != nil {
+				fmt.Printf("Failed to release expired reservations: %v\n", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,41 @@
+package mail
+
+import (
+	"os"
+	"sync"
+)
+
+// FileMailer appends every message to a file instead of delivering it, so
+// links in development emails can be read without an SMTP server.
+type FileMailer struct {
+	path string
+	from string
+
+	mu sync.Mutex
+}
+
+func NewFileMailer(path, from string) *FileMailer {
+	return &FileMailer{path: path, from: from}
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	body, err := format(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(body, "\r\n"...)); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,226 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"github.com/mikeudacha/paybuy/models"
+	"github.com/mikeudacha/paybuy/services/auth"
+	"github.com/mikeudacha/paybuy/utils"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+type Handler struct {
+	store          models.OrderStore
+	userStore      models.UserStore
+	blacklistStore *auth.BlacklistStore
+}
+
+func NewHandler(store models.OrderStore, userStore models.UserStore, blacklistStore *auth.BlacklistStore) *Handler {
+	return &Handler{
+		store:          store,
+		userStore:      userStore,
+		blacklistStore: blacklistStore,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/orders", auth.WithJWTAuth(h.handleGetOrders, h.userStore, h.blacklistStore)).Methods(http.MethodGet)
+	router.HandleFunc("/orders/{orderID}", auth.WithJWTAuth(h.handleGetOrder, h.userStore, h.blacklistStore)).Methods(http.MethodGet)
+	router.HandleFunc("/orders/{orderID}/cancel", auth.WithJWTAuth(h.handleCancelOrder, h.userStore, h.blacklistStore)).Methods(http.MethodPost)
+}
+
+func (h *Handler) handleGetOrders(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	filter, err := parseOrderFilter(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	orders, total, err := h.store.GetOrdersByUserID(userID, filter)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, models.OrderListResponse{
+		Orders: orders,
+		Page:   filter.Page,
+		Limit:  filter.Limit,
+		Total:  total,
+	})
+}
+
+func (h *Handler) handleGetOrder(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	orderID, err := getOrderIDFromRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	order, err := h.store.GetOrderByID(orderID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if order == nil || order.UserID != userID {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("order not found"))
+		return
+	}
+
+	items, err := h.store.GetOrderItems(order.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	discounts, err := h.store.GetOrderDiscounts(order.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	history, err := h.store.GetStatusHistory(order.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, models.OrderDetail{
+		Order:     *order,
+		Items:     items,
+		Discounts: discounts,
+		History:   history,
+	})
+}
+
+func (h *Handler) handleCancelOrder(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	orderID, err := getOrderIDFromRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var payload models.CancelOrderPayload
+	if err := utils.ParseJSON(r, &payload); err != nil && err != io.EOF {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return
+	}
+
+	order, err := h.store.GetOrderByID(orderID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if order == nil || order.UserID != userID {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("order not found"))
+		return
+	}
+
+	order, err = h.store.TransitionStatus(orderID, StatusCancelled, &userID, payload.Reason)
+	if errors.Is(err, ErrInvalidTransition) {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("order cannot be cancelled"))
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, order)
+}
+
+func getOrderIDFromRequest(r *http.Request) (int, error) {
+	vars := mux.Vars(r)
+	str, ok := vars["orderID"]
+	if !ok {
+		return 0, fmt.Errorf("missing order ID")
+	}
+
+	orderID, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid order ID")
+	}
+
+	return orderID, nil
+}
+
+func parseOrderFilter(r *http.Request) (models.OrderFilter, error) {
+	query := r.URL.Query()
+	filter := models.OrderFilter{
+		Status: query.Get("status"),
+		Page:   1,
+		Limit:  defaultPageLimit,
+	}
+
+	if filter.Status != "" && !IsValidStatus(filter.Status) {
+		return filter, fmt.Errorf("invalid status")
+	}
+
+	if str := query.Get("page"); str != "" {
+		page, err := strconv.Atoi(str)
+		if err != nil || page < 1 {
+			return filter, fmt.Errorf("invalid page")
+		}
+		filter.Page = page
+	}
+
+	if str := query.Get("limit"); str != "" {
+		limit, err := strconv.Atoi(str)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+		filter.Limit = limit
+	}
+
+	if str := query.Get("from"); str != "" {
+		from, err := parseDate(str)
+		if err != nil {
+			return filter, fmt.Errorf("invalid from date")
+		}
+		filter.From = &from
+	}
+
+	if str := query.Get("to"); str != "" {
+		to, err := parseDate(str)
+		if err != nil {
+			return filter, fmt.Errorf("invalid to date")
+		}
+		// A bare date includes the whole day.
+		if len(str) == len(time.DateOnly) {
+			to = to.AddDate(0, 0, 1)
+		}
+		filter.To = &to
+	}
+
+	return filter, nil
+}
+
+func parseDate(str string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, str); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, str)
+}
@@ -0,0 +1,52 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusPaid      = "paid"
+	StatusShipped   = "shipped"
+	StatusCompleted = "completed"
+	StatusCancelled = "cancelled"
+	StatusRefunded  = "refunded"
+)
+
+var ErrInvalidTransition = errors.New("invalid order status transition")
+
+// transitions lists, for every status, the statuses an order may move to.
+// Cancelled and refunded are terminal.
+var transitions = map[string][]string{
+	StatusPending:   {StatusPaid, StatusCancelled},
+	StatusPaid:      {StatusShipped, StatusRefunded},
+	StatusShipped:   {StatusCompleted, StatusRefunded},
+	StatusCompleted: {StatusRefunded},
+	StatusCancelled: {},
+	StatusRefunded:  {},
+}
+
+func IsValidStatus(status string) bool {
+	_, ok := transitions[status]
+	return ok
+}
+
+func CanTransition(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+func validateTransition(from, to string) error {
+	if !IsValidStatus(to) {
+		return fmt.Errorf("unknown order status %q", to)
+	}
+	if !CanTransition(from, to) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, to)
+	}
+	return nil
+}
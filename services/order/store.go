@@ -2,30 +2,413 @@ package order
 
 import (
 	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mikeudacha/paybuy/db"
 	"github.com/mikeudacha/paybuy/models"
 )
 
+const orderColumns = `id, user_id, subtotal, discount_total, tax_total, shipping_total, total, currency,
+	exchange_rate, status, address, shipping_address, shipping_method, tax_country, tax_region, created_at`
+
 type Store struct {
-	pool *pgxpool.Pool
+	pool      *pgxpool.Pool
+	inventory models.InventoryStore
+	coupons   models.CouponStore
 }
 
-func NewStore(pool *pgxpool.Pool) *Store {
-	return &Store{pool: pool}
+func NewStore(pool *pgxpool.Pool, inventory models.InventoryStore, coupons models.CouponStore) *Store {
+	return &Store{pool: pool, inventory: inventory, coupons: coupons}
 }
 
 func (s *Store) CreateOrder(order models.Order) (int, error) {
+	return createOrder(s.pool, order)
+}
+
+func (s *Store) CreateOrderTx(tx pgx.Tx, order models.Order) (int, error) {
+	return createOrder(tx, order)
+}
+
+func (s *Store) CreateOrderItem(orderItem models.OrderItem) error {
+	return createOrderItem(s.pool, orderItem)
+}
+
+func (s *Store) CreateOrderItemTx(tx pgx.Tx, orderItem models.OrderItem) error {
+	return createOrderItem(tx, orderItem)
+}
+
+func (s *Store) GetOrdersByUserID(userID int, filter models.OrderFilter) ([]models.Order, int, error) {
+	conditions := []string{"user_id = $1"}
+	args := []any{userID}
+
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+	where := strings.Join(conditions, " AND ")
+
+	var total int
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM orders WHERE %s`, where)
+	if err := s.pool.QueryRow(context.Background(), query, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, filter.Limit, (filter.Page-1)*filter.Limit)
+	query = fmt.Sprintf(`
+		SELECT `+orderColumns+`
+		FROM orders
+		WHERE %s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)-1, len(args))
+
+	rows, err := s.pool.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	orders := make([]models.Order, 0)
+	for rows.Next() {
+		o, err := scanRowsIntoOrder(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		orders = append(orders, *o)
+	}
+
+	return orders, total, rows.Err()
+}
+
+func (s *Store) GetOrderByID(id int) (*models.Order, error) {
+	query := `SELECT ` + orderColumns + ` FROM orders WHERE id = $1`
+	rows, err := s.pool.Query(context.Background(), query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		return scanRowsIntoOrder(rows)
+	}
+
+	return nil, nil
+}
+
+func (s *Store) GetOrderItems(orderID int) ([]models.OrderItem, error) {
+	query := `
+		SELECT oi.id, oi.order_id, oi.product_id, oi.product_name, oi.product_image, oi.quantity, oi.price, o.currency,
+			oi.tax_category, oi.tax_rate::text, oi.tax_amount, oi.created_at
+		FROM order_items oi
+		JOIN orders o ON o.id = oi.order_id
+		WHERE oi.order_id = $1
+		ORDER BY oi.id
+	`
+	rows, err := s.pool.Query(context.Background(), query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]models.OrderItem, 0)
+	for rows.Next() {
+		item, err := scanRowsIntoOrderItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, *item)
+	}
+
+	return items, rows.Err()
+}
+
+// TransitionStatus moves an order to the status to in its own transaction.
+// See TransitionStatusTx.
+func (s *Store) TransitionStatus(orderID int, to string, changedBy *int, note string) (*models.Order, error) {
+	ctx := context.Background()
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	order, err := s.TransitionStatusTx(tx, orderID, to, changedBy, note)
+	if err != nil {
+		return nil, err
+	}
+
+	return order, tx.Commit(ctx)
+}
+
+// TransitionStatusTx locks the order, checks that moving it to the status to
+// is a legal transition and records the change in the status history. Paying
+// an order turns its stock reservations into deductions; cancelling it
+// releases them together with any coupon redemption.
+func (s *Store) TransitionStatusTx(tx pgx.Tx, orderID int, to string, changedBy *int, note string) (*models.Order, error) {
+	ctx := context.Background()
+
+	query := `SELECT ` + orderColumns + ` FROM orders WHERE id = $1 FOR UPDATE`
+	rows, err := tx.Query(ctx, query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if !rows.Next() {
+		rows.Close()
+		return nil, fmt.Errorf("order %d not found", orderID)
+	}
+	order, err := scanRowsIntoOrder(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateTransition(order.Status, to); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE orders SET status = $1 WHERE id = $2`, to, orderID); err != nil {
+		return nil, err
+	}
+
+	query = `INSERT INTO order_status_history (order_id, from_status, to_status, changed_by, note) VALUES ($1, $2, $3, $4, $5)`
+	if _, err := tx.Exec(ctx, query, orderID, order.Status, to, changedBy, note); err != nil {
+		return nil, err
+	}
+
+	switch to {
+	case StatusPaid:
+		if err := s.inventory.ConvertReservationsTx(tx, orderID, changedBy); err != nil {
+			return nil, err
+		}
+	case StatusCancelled:
+		if err := s.inventory.ReleaseReservationsTx(tx, orderID, changedBy); err != nil {
+			return nil, err
+		}
+		if err := s.coupons.ReleaseRedemptionsTx(tx, orderID); err != nil {
+			return nil, err
+		}
+	}
+
+	order.Status = to
+	return order, nil
+}
+
+func (s *Store) GetStatusHistory(orderID int) ([]models.OrderStatusChange, error) {
+	query := `
+		SELECT id, order_id, from_status, to_status, changed_by, note, created_at
+		FROM order_status_history
+		WHERE order_id = $1
+		ORDER BY id
+	`
+	rows, err := s.pool.Query(context.Background(), query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make([]models.OrderStatusChange, 0)
+	for rows.Next() {
+		var change models.OrderStatusChange
+		err := rows.Scan(
+			&change.ID,
+			&change.OrderID,
+			&change.FromStatus,
+			&change.ToStatus,
+			&change.ChangedBy,
+			&change.Note,
+			&change.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, change)
+	}
+
+	return history, rows.Err()
+}
+
+func (s *Store) CreateOrderDiscountTx(tx pgx.Tx, discount models.OrderDiscount) error {
+	query := `
+		INSERT INTO order_discounts (order_id, coupon_id, coupon_code, type, description, amount, free_shipping)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := tx.Exec(context.Background(), query,
+		discount.OrderID,
+		discount.CouponID,
+		discount.CouponCode,
+		discount.Type,
+		discount.Description,
+		discount.Amount,
+		discount.FreeShipping,
+	)
+	return err
+}
+
+func (s *Store) GetOrderDiscounts(orderID int) ([]models.OrderDiscount, error) {
+	query := `
+		SELECT d.id, d.order_id, COALESCE(d.coupon_id, 0), d.coupon_code, d.type, d.description, d.amount, o.currency, d.free_shipping, d.created_at
+		FROM order_discounts d
+		JOIN orders o ON o.id = d.order_id
+		WHERE d.order_id = $1
+		ORDER BY d.id
+	`
+	rows, err := s.pool.Query(context.Background(), query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	discounts := make([]models.OrderDiscount, 0)
+	for rows.Next() {
+		var discount models.OrderDiscount
+		var currency string
+		err := rows.Scan(
+			&discount.ID,
+			&discount.OrderID,
+			&discount.CouponID,
+			&discount.CouponCode,
+			&discount.Type,
+			&discount.Description,
+			&discount.Amount,
+			&currency,
+			&discount.FreeShipping,
+			&discount.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		discount.Amount = discount.Amount.WithCurrency(currency)
+		discounts = append(discounts, discount)
+	}
+
+	return discounts, rows.Err()
+}
+
+func createOrder(q db.Querier, order models.Order) (int, error) {
 	var id int
-	query := `INSERT INTO orders (user_id, total, status, address) VALUES($1, $2, $3, $4) RETURNING id`
-	err := s.pool.QueryRow(context.Background(), query, order.UserID, order.Total, order.Status, order.Address).Scan(&id)
+	query := `
+		WITH o AS (
+			INSERT INTO orders (user_id, subtotal, discount_total, tax_total, shipping_total, total, currency,
+				exchange_rate, status, address, shipping_address, shipping_method, tax_country, tax_region)
+			VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+			RETURNING id
+		)
+		INSERT INTO order_status_history (order_id, to_status, changed_by)
+		SELECT id, $9, $1 FROM o
+		RETURNING order_id
+	`
+	err := q.QueryRow(context.Background(), query,
+		order.UserID,
+		order.Subtotal,
+		order.DiscountTotal,
+		order.TaxTotal,
+		order.ShippingTotal,
+		order.Total,
+		order.Total.Currency,
+		order.ExchangeRate,
+		order.Status,
+		order.Address,
+		order.ShippingAddress,
+		order.ShippingMethod,
+		order.TaxCountry,
+		order.TaxRegion,
+	).Scan(&id)
 	if err != nil {
 		return 0, err
 	}
 	return id, nil
 }
 
-func (s *Store) CreateOrderItem(orderItem models.OrderItem) error {
-	query := `INSERT INTO order_items (order_id, product_id, quantity, price) VALUES ($1, $2, $3, $4)`
-	_, err := s.pool.Exec(context.Background(), query, orderItem.OrderID, orderItem.ProductID, orderItem.Quantity, orderItem.Price)
+func createOrderItem(q db.Querier, orderItem models.OrderItem) error {
+	query := `
+		INSERT INTO order_items (order_id, product_id, product_name, product_image, quantity, price, tax_category, tax_rate, tax_amount)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	_, err := q.Exec(context.Background(), query,
+		orderItem.OrderID,
+		orderItem.ProductID,
+		orderItem.ProductName,
+		orderItem.ProductImage,
+		orderItem.Quantity,
+		orderItem.Price,
+		orderItem.TaxCategory,
+		orderItem.TaxRate,
+		orderItem.Tax,
+	)
 	return err
 }
+
+func scanRowsIntoOrder(rows pgx.Rows) (*models.Order, error) {
+	order := new(models.Order)
+
+	var currency string
+	err := rows.Scan(
+		&order.ID,
+		&order.UserID,
+		&order.Subtotal,
+		&order.DiscountTotal,
+		&order.TaxTotal,
+		&order.ShippingTotal,
+		&order.Total,
+		&currency,
+		&order.ExchangeRate,
+		&order.Status,
+		&order.Address,
+		&order.ShippingAddress,
+		&order.ShippingMethod,
+		&order.TaxCountry,
+		&order.TaxRegion,
+		&order.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	order.Subtotal = order.Subtotal.WithCurrency(currency)
+	order.DiscountTotal = order.DiscountTotal.WithCurrency(currency)
+	order.TaxTotal = order.TaxTotal.WithCurrency(currency)
+	order.ShippingTotal = order.ShippingTotal.WithCurrency(currency)
+	order.Total = order.Total.WithCurrency(currency)
+
+	return order, nil
+}
+
+func scanRowsIntoOrderItem(rows pgx.Rows) (*models.OrderItem, error) {
+	item := new(models.OrderItem)
+
+	var currency string
+	err := rows.Scan(
+		&item.ID,
+		&item.OrderID,
+		&item.ProductID,
+		&item.ProductName,
+		&item.ProductImage,
+		&item.Quantity,
+		&item.Price,
+		&currency,
+		&item.TaxCategory,
+		&item.TaxRate,
+		&item.Tax,
+		&item.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	item.Price = item.Price.WithCurrency(currency)
+	item.Tax = item.Tax.WithCurrency(currency)
+
+	return item, nil
+}
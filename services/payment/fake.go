@@ -0,0 +1,127 @@
+package payment
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/mikeudacha/paybuy/money"
+)
+
+type fakePayment struct {
+	amount   money.Money
+	captured money.Money
+	refunded money.Money
+	status   string
+}
+
+// FakeGateway is an in-process gateway for development and tests. It
+// authorizes and captures synchronously and keeps all state in memory.
+// Authorizations above DeclineAbove (in minor units) are declined when it is
+// non-zero.
+type FakeGateway struct {
+	DeclineAbove int64
+
+	mu       sync.Mutex
+	nextID   int
+	payments map[string]*fakePayment
+}
+
+func NewFakeGateway() *FakeGateway {
+	return &FakeGateway{payments: make(map[string]*fakePayment)}
+}
+
+func (g *FakeGateway) Name() string {
+	return "fake"
+}
+
+func (g *FakeGateway) Authorize(req AuthorizeRequest) (*GatewayResult, error) {
+	if !req.Amount.IsPositive() {
+		return nil, fmt.Errorf("amount must be positive")
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.nextID++
+	id := fmt.Sprintf("fake_pay_%d", g.nextID)
+
+	zero := money.Zero(req.Amount.Currency)
+
+	if g.DeclineAbove > 0 && req.Amount.Amount > g.DeclineAbove {
+		g.payments[id] = &fakePayment{amount: req.Amount, captured: zero, refunded: zero, status: StatusFailed}
+		return nil, ErrPaymentDeclined
+	}
+
+	g.payments[id] = &fakePayment{amount: req.Amount, captured: zero, refunded: zero, status: StatusAuthorized}
+
+	return &GatewayResult{ProviderPaymentID: id, Status: StatusAuthorized}, nil
+}
+
+func (g *FakeGateway) Capture(providerPaymentID string, amount money.Money) (*GatewayResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p, err := g.get(providerPaymentID)
+	if err != nil {
+		return nil, err
+	}
+	if p.status != StatusAuthorized {
+		return nil, fmt.Errorf("cannot capture payment in status %s", p.status)
+	}
+	if amount.Currency != p.amount.Currency || amount.Cmp(p.amount) > 0 {
+		return nil, fmt.Errorf("capture amount exceeds authorized amount")
+	}
+
+	p.captured = amount
+	p.status = StatusCaptured
+
+	return &GatewayResult{ProviderPaymentID: providerPaymentID, Status: p.status}, nil
+}
+
+func (g *FakeGateway) Void(providerPaymentID string) (*GatewayResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p, err := g.get(providerPaymentID)
+	if err != nil {
+		return nil, err
+	}
+	if p.status != StatusAuthorized {
+		return nil, fmt.Errorf("cannot void payment in status %s", p.status)
+	}
+
+	p.status = StatusVoided
+
+	return &GatewayResult{ProviderPaymentID: providerPaymentID, Status: p.status}, nil
+}
+
+func (g *FakeGateway) Refund(providerPaymentID string, amount money.Money) (*GatewayResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p, err := g.get(providerPaymentID)
+	if err != nil {
+		return nil, err
+	}
+	if p.status != StatusCaptured {
+		return nil, fmt.Errorf("cannot refund payment in status %s", p.status)
+	}
+	if amount.Currency != p.captured.Currency || p.refunded.Add(amount).Cmp(p.captured) > 0 {
+		return nil, fmt.Errorf("refund amount exceeds captured amount")
+	}
+
+	p.refunded = p.refunded.Add(amount)
+	if p.refunded.Cmp(p.captured) == 0 {
+		p.status = StatusRefunded
+	}
+
+	return &GatewayResult{ProviderPaymentID: providerPaymentID, Status: p.status}, nil
+}
+
+func (g *FakeGateway) get(providerPaymentID string) (*fakePayment, error) {
+	p, ok := g.payments[providerPaymentID]
+	if !ok {
+		return nil, fmt.Errorf("payment %s not found", providerPaymentID)
+	}
+	return p, nil
+}
@@ -0,0 +1,42 @@
+package payment
+
+import (
+	"errors"
+
+	"github.com/mikeudacha/paybuy/money"
+)
+
+const (
+	StatusPending    = "pending"
+	StatusAuthorized = "authorized"
+	StatusCaptured   = "captured"
+	StatusVoided     = "voided"
+	StatusRefunded   = "refunded"
+	StatusFailed     = "failed"
+)
+
+var (
+	ErrPaymentDeclined = errors.New("payment declined")
+	ErrPaymentNotFound = errors.New("payment not found")
+)
+
+type AuthorizeRequest struct {
+	Reference string
+	Amount    money.Money
+}
+
+// GatewayResult is the provider's view of a payment after an operation.
+// Status is one of the Status constants; providers that confirm
+// asynchronously report StatusPending and follow up with a webhook.
+type GatewayResult struct {
+	ProviderPaymentID string
+	Status            string
+}
+
+type PaymentGateway interface {
+	Name() string
+	Authorize(req AuthorizeRequest) (*GatewayResult, error)
+	Capture(providerPaymentID string, amount money.Money) (*GatewayResult, error)
+	Void(providerPaymentID string) (*GatewayResult, error)
+	Refund(providerPaymentID string, amount money.Money) (*GatewayResult, error)
+}
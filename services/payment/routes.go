@@ -0,0 +1,63 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mikeudacha/paybuy/utils"
+)
+
+const maxWebhookBodyLen = 1 << 20
+
+type Handler struct {
+	service       *Service
+	webhookSecret string
+}
+
+func NewHandler(service *Service, webhookSecret string) *Handler {
+	return &Handler{
+		service:       service,
+		webhookSecret: webhookSecret,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/webhooks/payments", h.handlePaymentWebhook).Methods(http.MethodPost)
+}
+
+func (h *Handler) handlePaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBodyLen))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to read request body"))
+		return
+	}
+
+	if err := VerifyWebhookSignature(h.webhookSecret, r.Header.Get(SignatureHeader), body, time.Now()); err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid signature: %v", err))
+		return
+	}
+
+	event, err := ParseWebhookEvent(body)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	outcome, err := h.service.HandleWebhookEvent(event, body)
+	if errors.Is(err, ErrPaymentNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{
+		"status": outcome,
+	})
+}
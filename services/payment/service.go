@@ -0,0 +1,211 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mikeudacha/paybuy/models"
+	"github.com/mikeudacha/paybuy/services/order"
+)
+
+type Service struct {
+	gateway    PaymentGateway
+	store      models.PaymentStore
+	orderStore models.OrderStore
+	transactor models.Transactor
+}
+
+func NewService(gateway PaymentGateway, store models.PaymentStore, orderStore models.OrderStore, transactor models.Transactor) *Service {
+	return &Service{
+		gateway:    gateway,
+		store:      store,
+		orderStore: orderStore,
+		transactor: transactor,
+	}
+}
+
+// StartPayment creates a payment intent for the order total and asks the
+// gateway to authorize and capture it. The order moves to paid only once the
+// gateway reports the capture; a declined payment cancels the order, which
+// returns its items to stock. Gateways that confirm asynchronously leave the
+// payment pending until their webhook arrives.
+func (s *Service) StartPayment(o models.Order) (*models.Payment, error) {
+	payment := models.Payment{
+		OrderID:  o.ID,
+		Provider: s.gateway.Name(),
+		Amount:   o.Total,
+		Currency: o.Total.Currency,
+		Status:   StatusPending,
+	}
+
+	id, err := s.store.CreatePayment(payment)
+	if err != nil {
+		return nil, err
+	}
+	payment.ID = id
+
+	result, err := s.gateway.Authorize(AuthorizeRequest{
+		Reference: fmt.Sprintf("order_%d", o.ID),
+		Amount:    payment.Amount,
+	})
+	if err != nil {
+		return s.fail(payment, err)
+	}
+	payment.ProviderPaymentID = &result.ProviderPaymentID
+	payment.Status = result.Status
+
+	if result.Status == StatusAuthorized {
+		if err := s.store.UpdatePayment(payment); err != nil {
+			return nil, err
+		}
+
+		result, err = s.gateway.Capture(result.ProviderPaymentID, payment.Amount)
+		if err != nil {
+			if _, voidErr := s.gateway.Void(*payment.ProviderPaymentID); voidErr != nil {
+				log.Printf("payment: failed to void payment %d: %v", payment.ID, voidErr)
+			}
+			return s.fail(payment, err)
+		}
+		payment.Status = result.Status
+	}
+
+	if payment.Status != StatusCaptured {
+		return &payment, s.store.UpdatePayment(payment)
+	}
+
+	err = s.transactor.WithTx(func(tx pgx.Tx) error {
+		if err := s.store.UpdatePaymentTx(tx, payment); err != nil {
+			return err
+		}
+		_, err := s.orderStore.TransitionStatusTx(tx, o.ID, order.StatusPaid, nil, "payment captured")
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &payment, nil
+}
+
+// HandleWebhookEvent applies a verified provider event to the payment and its
+// order. Events are recorded in the same transaction, so an event is applied
+// at most once and a failed attempt can be safely redelivered. It returns one
+// of the Webhook outcomes. A capture that arrives after the order was
+// cancelled is refunded at the gateway rather than left unaccounted for.
+func (s *Service) HandleWebhookEvent(event *WebhookEvent, payload []byte) (string, error) {
+	outcome := WebhookProcessed
+
+	err := s.transactor.WithTx(func(tx pgx.Tx) error {
+		recorded, err := s.store.RecordWebhookEventTx(tx, s.gateway.Name(), event.ID, event.Type, payload)
+		if err != nil {
+			return err
+		}
+		if !recorded {
+			outcome = WebhookDuplicate
+			return nil
+		}
+
+		payment, err := s.store.GetPaymentByProviderIDForUpdate(tx, s.gateway.Name(), event.Data.ProviderPaymentID)
+		if err != nil {
+			return err
+		}
+		if payment == nil {
+			return ErrPaymentNotFound
+		}
+
+		var orderStatus, note string
+		switch event.Type {
+		case EventPaymentAuthorized:
+			payment.Status = StatusAuthorized
+		case EventPaymentCaptured:
+			payment.Status = StatusCaptured
+			orderStatus, note = order.StatusPaid, "payment captured"
+		case EventPaymentFailed:
+			payment.Status = StatusFailed
+			payment.FailureReason = event.Data.Reason
+			orderStatus, note = order.StatusCancelled, "payment failed"
+		case EventPaymentRefunded:
+			payment.Status = StatusRefunded
+			orderStatus, note = order.StatusRefunded, "payment refunded"
+		default:
+			log.Printf("payment: ignoring webhook event %s of type %s", event.ID, event.Type)
+			return nil
+		}
+
+		if err := s.store.UpdatePaymentTx(tx, *payment); err != nil {
+			return err
+		}
+
+		if orderStatus == "" {
+			return nil
+		}
+
+		_, err = s.orderStore.TransitionStatusTx(tx, payment.OrderID, orderStatus, nil, note)
+		if !errors.Is(err, order.ErrInvalidTransition) {
+			return err
+		}
+
+		if event.Type == EventPaymentCaptured {
+			o, err := s.orderStore.GetOrderByID(payment.OrderID)
+			if err != nil {
+				return err
+			}
+			if o.Status == order.StatusCancelled {
+				outcome = WebhookRefunded
+				return s.refundOrphanedCaptureTx(tx, *payment)
+			}
+		}
+
+		// The order already reflects this event, e.g. a synchronous capture
+		// followed by its confirmation webhook.
+		log.Printf("payment: webhook event %s for order %d: %v", event.ID, payment.OrderID, err)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return outcome, nil
+}
+
+// refundOrphanedCaptureTx refunds a payment the provider captured after its
+// order was cancelled. A gateway error rolls back the event so the provider
+// redelivers it and the refund is retried.
+func (s *Service) refundOrphanedCaptureTx(tx pgx.Tx, payment models.Payment) error {
+	result, err := s.gateway.Refund(*payment.ProviderPaymentID, payment.Amount)
+	if err != nil {
+		return fmt.Errorf("refund capture for cancelled order %d: %w", payment.OrderID, err)
+	}
+
+	log.Printf("payment: refunded payment %d captured after order %d was cancelled", payment.ID, payment.OrderID)
+
+	payment.Status = result.Status
+	payment.FailureReason = "captured after order was cancelled"
+	return s.store.UpdatePaymentTx(tx, payment)
+}
+
+func (s *Service) fail(payment models.Payment, cause error) (*models.Payment, error) {
+	payment.Status = StatusFailed
+	payment.FailureReason = cause.Error()
+
+	// The failure and the cancellation commit together so the order's stock
+	// and coupon redemption are never left held for a failed payment.
+	err := s.transactor.WithTx(func(tx pgx.Tx) error {
+		if err := s.store.UpdatePaymentTx(tx, payment); err != nil {
+			return err
+		}
+		_, err := s.orderStore.TransitionStatusTx(tx, payment.OrderID, order.StatusCancelled, nil, "payment failed")
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if errors.Is(cause, ErrPaymentDeclined) {
+		return &payment, cause
+	}
+
+	return &payment, fmt.Errorf("%w: %v", ErrPaymentDeclined, cause)
+}
@@ -0,0 +1,147 @@
+package payment
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mikeudacha/paybuy/db"
+	"github.com/mikeudacha/paybuy/models"
+)
+
+type Store struct {
+	pool *pgxpool.Pool
+}
+
+func NewStore(pool *pgxpool.Pool) *Store {
+	return &Store{pool: pool}
+}
+
+func (s *Store) CreatePayment(payment models.Payment) (int, error) {
+	var id int
+	query := `
+		INSERT INTO payments (order_id, provider, provider_payment_id, amount, currency, status)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`
+	err := s.pool.QueryRow(context.Background(), query,
+		payment.OrderID,
+		payment.Provider,
+		payment.ProviderPaymentID,
+		payment.Amount,
+		payment.Currency,
+		payment.Status,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *Store) UpdatePayment(payment models.Payment) error {
+	return updatePayment(s.pool, payment)
+}
+
+func (s *Store) UpdatePaymentTx(tx pgx.Tx, payment models.Payment) error {
+	return updatePayment(tx, payment)
+}
+
+func (s *Store) GetPaymentsByOrderID(orderID int) ([]models.Payment, error) {
+	query := `
+		SELECT id, order_id, provider, provider_payment_id, amount, currency, status, failure_reason, created_at, updated_at
+		FROM payments
+		WHERE order_id = $1
+		ORDER BY id
+	`
+	rows, err := s.pool.Query(context.Background(), query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := make([]models.Payment, 0)
+	for rows.Next() {
+		p, err := scanRowsIntoPayment(rows)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, *p)
+	}
+
+	return payments, rows.Err()
+}
+
+// GetPaymentByProviderIDForUpdate returns the payment and locks it until tx
+// finishes, or nil when the provider payment is unknown.
+func (s *Store) GetPaymentByProviderIDForUpdate(tx pgx.Tx, provider, providerPaymentID string) (*models.Payment, error) {
+	query := `
+		SELECT id, order_id, provider, provider_payment_id, amount, currency, status, failure_reason, created_at, updated_at
+		FROM payments
+		WHERE provider = $1 AND provider_payment_id = $2
+		FOR UPDATE
+	`
+	rows, err := tx.Query(context.Background(), query, provider, providerPaymentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		return scanRowsIntoPayment(rows)
+	}
+
+	return nil, rows.Err()
+}
+
+// RecordWebhookEventTx stores a provider event and reports whether it was new.
+// A false result means the event was already processed.
+func (s *Store) RecordWebhookEventTx(tx pgx.Tx, provider, eventID, eventType string, payload []byte) (bool, error) {
+	query := `
+		INSERT INTO payment_webhook_events (provider, event_id, event_type, payload)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (provider, event_id) DO NOTHING
+	`
+	tag, err := tx.Exec(context.Background(), query, provider, eventID, eventType, payload)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func updatePayment(q db.Querier, payment models.Payment) error {
+	query := `
+		UPDATE payments
+		SET provider_payment_id = $1, status = $2, failure_reason = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4
+	`
+	_, err := q.Exec(context.Background(), query,
+		payment.ProviderPaymentID,
+		payment.Status,
+		payment.FailureReason,
+		payment.ID,
+	)
+	return err
+}
+
+func scanRowsIntoPayment(rows pgx.Rows) (*models.Payment, error) {
+	payment := new(models.Payment)
+
+	err := rows.Scan(
+		&payment.ID,
+		&payment.OrderID,
+		&payment.Provider,
+		&payment.ProviderPaymentID,
+		&payment.Amount,
+		&payment.Currency,
+		&payment.Status,
+		&payment.FailureReason,
+		&payment.CreatedAt,
+		&payment.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	payment.Amount = payment.Amount.WithCurrency(payment.Currency)
+
+	return payment, nil
+}
@@ -0,0 +1,114 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SignatureHeader    = "Paybuy-Signature"
+	SignatureTolerance = 5 * time.Minute
+)
+
+const (
+	EventPaymentAuthorized = "payment.authorized"
+	EventPaymentCaptured   = "payment.captured"
+	EventPaymentFailed     = "payment.failed"
+	EventPaymentRefunded   = "payment.refunded"
+)
+
+// Outcomes reported back to the provider for a delivered event.
+const (
+	WebhookProcessed = "processed"
+	WebhookDuplicate = "duplicate"
+	// WebhookRefunded means the payment was captured for an order that had
+	// already been cancelled, so the capture was refunded instead of applied.
+	WebhookRefunded = "refunded"
+)
+
+type WebhookEvent struct {
+	ID   string           `json:"id"`
+	Type string           `json:"type"`
+	Data WebhookEventData `json:"data"`
+}
+
+type WebhookEventData struct {
+	ProviderPaymentID string `json:"providerPaymentID"`
+	Reason            string `json:"reason,omitempty"`
+}
+
+func ParseWebhookEvent(body []byte) (*WebhookEvent, error) {
+	var event WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+	if event.ID == "" || event.Type == "" || event.Data.ProviderPaymentID == "" {
+		return nil, fmt.Errorf("webhook event is missing id, type or providerPaymentID")
+	}
+	return &event, nil
+}
+
+// SignWebhookPayload returns the signature header value for body, in the form
+// "t=<unix timestamp>,v1=<hex HMAC-SHA256 of "<timestamp>.<body>">".
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, computeSignature(secret, timestamp, body))
+}
+
+// VerifyWebhookSignature checks header against body and rejects signatures
+// older or newer than SignatureTolerance to limit replay of captured requests.
+func VerifyWebhookSignature(secret, header string, body []byte, now time.Time) error {
+	if secret == "" {
+		return fmt.Errorf("webhook secret is not configured")
+	}
+
+	var timestamp int64
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			ts, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid signature timestamp")
+			}
+			timestamp = ts
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	if timestamp == 0 || len(signatures) == 0 {
+		return fmt.Errorf("malformed signature header")
+	}
+
+	age := now.Sub(time.Unix(timestamp, 0))
+	if age > SignatureTolerance || age < -SignatureTolerance {
+		return fmt.Errorf("signature timestamp outside tolerance")
+	}
+
+	expected := []byte(computeSignature(secret, timestamp, body))
+	for _, signature := range signatures {
+		if hmac.Equal(expected, []byte(signature)) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("signature mismatch")
+}
+
+func computeSignature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,103 @@
+package product
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/mikeudacha/paybuy/models"
+	"github.com/mikeudacha/paybuy/money"
+)
+
+const (
+	SortCreatedAt = "created_at"
+	SortPrice     = "price"
+	SortName      = "name"
+
+	// SortRank orders search results by relevance. It is not accepted by
+	// the product listing.
+	SortRank = "rank"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursorTimeLayout matches the text form of a TIMESTAMP column.
+const cursorTimeLayout = "2006-01-02 15:04:05.999999"
+
+// cursor is the position after the last product of a page: its value in the
+// sort column and its id, which breaks ties between equal values. Sort and
+// direction are included so a cursor cannot be replayed against a different
+// ordering.
+type cursor struct {
+	Sort       string `json:"s"`
+	Descending bool   `json:"d"`
+	Value      string `json:"v"`
+	ID         int    `json:"id"`
+}
+
+func (c cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// listCursor is the cursor following last in a product listing.
+func listCursor(filter models.ProductFilter, last *models.Product) cursor {
+	c := cursor{Sort: filter.Sort, Descending: filter.Descending, ID: last.ID}
+	switch filter.Sort {
+	case SortPrice:
+		c.Value = last.Price.String()
+	case SortName:
+		c.Value = last.Name
+	default:
+		c.Value = last.CreatedAt.UTC().Format(cursorTimeLayout)
+	}
+
+	return c
+}
+
+// searchCursor is the cursor following last in search results, which are
+// ordered by rank.
+func searchCursor(last models.ProductSearchResult) cursor {
+	return cursor{
+		Sort:       SortRank,
+		Descending: true,
+		Value:      strconv.FormatFloat(float64(last.Rank), 'g', -1, 32),
+		ID:         last.ID,
+	}
+}
+
+func decodeCursor(token, sort string, descending bool) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.Sort != sort || c.Descending != descending {
+		return nil, fmt.Errorf("%w: it does not match the requested sort order", ErrInvalidCursor)
+	}
+
+	switch c.Sort {
+	case SortCreatedAt:
+		_, err = time.Parse(cursorTimeLayout, c.Value)
+	case SortPrice:
+		// Rewritten in canonical decimal form, since Parse also accepts
+		// fractions like 1/3 that Postgres cannot cast to NUMERIC.
+		var price money.Money
+		price, err = money.Parse(c.Value, money.DefaultCurrency)
+		c.Value = price.String()
+	case SortRank:
+		_, err = strconv.ParseFloat(c.Value, 32)
+	}
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
@@ -1,45 +1,136 @@
 package product
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
 	"github.com/mikeudacha/paybuy/models"
+	"github.com/mikeudacha/paybuy/money"
 	"github.com/mikeudacha/paybuy/services/auth"
+	"github.com/mikeudacha/paybuy/services/idempotency"
+	"github.com/mikeudacha/paybuy/services/inventory"
+	"github.com/mikeudacha/paybuy/services/tax"
 	"github.com/mikeudacha/paybuy/utils"
 )
 
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
 type Handler struct {
-	store          models.ProductStore
-	userStore      models.UserStore
-	blacklistStore *auth.BlacklistStore
+	store            models.ProductStore
+	inventoryStore   models.InventoryStore
+	userStore        models.UserStore
+	blacklistStore   *auth.BlacklistStore
+	idempotencyStore models.IdempotencyStore
 }
 
-func NewHandler(store models.ProductStore, userStore models.UserStore, blacklistStore *auth.BlacklistStore) *Handler {
+func NewHandler(store models.ProductStore, inventoryStore models.InventoryStore, userStore models.UserStore, blacklistStore *auth.BlacklistStore, idempotencyStore models.IdempotencyStore) *Handler {
 	return &Handler{
-		store:          store,
-		userStore:      userStore,
-		blacklistStore: blacklistStore,
+		store:            store,
+		inventoryStore:   inventoryStore,
+		userStore:        userStore,
+		blacklistStore:   blacklistStore,
+		idempotencyStore: idempotencyStore,
 	}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc("/products", h.handleGetProducts).Methods(http.MethodGet)
+	// Registered before /products/{productID} so "search" is not taken for
+	// a product ID.
+	router.HandleFunc("/products/search", h.handleSearchProducts).Methods(http.MethodGet)
 	router.HandleFunc("/products/{productID}", h.handleGetProduct).Methods(http.MethodGet)
 
-	router.HandleFunc("/products", auth.WithJWTAuth(h.handleCreateProduct, h.userStore, h.blacklistStore)).Methods(http.MethodPost)
+	router.HandleFunc("/products", auth.WithJWTAuth(auth.RequireRole(idempotency.WithIdempotency(h.handleCreateProduct, h.idempotencyStore), auth.RoleStaff), h.userStore, h.blacklistStore)).Methods(http.MethodPost)
+	router.HandleFunc("/products/{productID}", auth.WithJWTAuth(auth.RequireRole(h.handleUpdateProduct, auth.RoleStaff), h.userStore, h.blacklistStore)).Methods(http.MethodPut)
+	router.HandleFunc("/products/{productID}", auth.WithJWTAuth(auth.RequireRole(h.handlePatchProduct, auth.RoleStaff), h.userStore, h.blacklistStore)).Methods(http.MethodPatch)
+	router.HandleFunc("/products/{productID}", auth.WithJWTAuth(auth.RequireRole(h.handleDeleteProduct, auth.RoleStaff), h.userStore, h.blacklistStore)).Methods(http.MethodDelete)
+	router.HandleFunc("/products/{productID}/prices", auth.WithJWTAuth(auth.RequireRole(h.handleSetProductPrices, auth.RoleStaff), h.userStore, h.blacklistStore)).Methods(http.MethodPut)
+	router.HandleFunc("/products/{productID}/stock-history", auth.WithJWTAuth(auth.RequireRole(h.handleGetStockHistory, auth.RoleStaff), h.userStore, h.blacklistStore)).Methods(http.MethodGet)
+	router.HandleFunc("/products/{productID}/stock-adjustments", auth.WithJWTAuth(auth.RequireRole(idempotency.WithIdempotency(h.handleAdjustStock, h.idempotencyStore), auth.RoleStaff), h.userStore, h.blacklistStore)).Methods(http.MethodPost)
 }
 
 func (h *Handler) handleGetProducts(w http.ResponseWriter, r *http.Request) {
-	products, err := h.store.GetProducts()
+	filter, err := parseProductFilter(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	products, nextCursor, total, err := h.store.GetProducts(filter)
+	if errors.Is(err, ErrInvalidCursor) {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, models.ProductListResponse{
+		Products:   products,
+		NextCursor: nextCursor,
+		Limit:      filter.Limit,
+		Total:      total,
+	})
+}
+
+func (h *Handler) handleSearchProducts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.ProductSearchFilter{
+		Query:  PrefixQuery(query.Get("q")),
+		Cursor: query.Get("cursor"),
+		Limit:  defaultPageLimit,
+	}
+	if filter.Query == "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("q must contain at least one word"))
+		return
+	}
+
+	if str := query.Get("limit"); str != "" {
+		limit, err := strconv.Atoi(str)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxPageLimit))
+			return
+		}
+		filter.Limit = limit
+	}
+
+	if str := query.Get("in_stock"); str != "" {
+		inStock, err := strconv.ParseBool(str)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid in_stock"))
+			return
+		}
+		filter.InStock = inStock
+	}
+
+	results, nextCursor, total, err := h.store.SearchProducts(filter)
+	if errors.Is(err, ErrInvalidCursor) {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
-	utils.WriteJSON(w, http.StatusOK, products)
+
+	utils.WriteJSON(w, http.StatusOK, models.ProductSearchResponse{
+		Results:    results,
+		NextCursor: nextCursor,
+		Limit:      filter.Limit,
+		Total:      total,
+	})
 }
 
 func (h *Handler) handleGetProduct(w http.ResponseWriter, r *http.Request) {
@@ -61,6 +152,10 @@ func (h *Handler) handleGetProduct(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
+	if product == nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("product not found"))
+		return
+	}
 
 	utils.WriteJSON(w, http.StatusOK, product)
 }
@@ -78,10 +173,368 @@ func (h *Handler) handleCreateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.store.CreateProduct(product)
+	if !product.Price.IsPositive() {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: price must be positive"))
+		return
+	}
+
+	if err := validatePriceList(product.Price.Currency, product.Prices); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if product.TaxCategory == "" {
+		product.TaxCategory = tax.DefaultCategory
+	}
+
+	err := h.store.CreateProduct(product, auth.GetUserIDFromContext(r.Context()))
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusCreated, product)
 }
+
+func (h *Handler) handleUpdateProduct(w http.ResponseWriter, r *http.Request) {
+	product, ok := h.getProduct(w, r)
+	if !ok {
+		return
+	}
+
+	// A bare amount such as "price": "9.99" is read in the product's current
+	// currency rather than the default.
+	payload := models.UpdateProductPayload{Price: money.Zero(product.Price.Currency)}
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	h.saveProduct(w, product, payload)
+}
+
+// handlePatchProduct applies a JSON merge patch to the product's editable
+// fields. Members outside UpdateProductPayload are rejected.
+func (h *Handler) handlePatchProduct(w http.ResponseWriter, r *http.Request) {
+	product, ok := h.getProduct(w, r)
+	if !ok {
+		return
+	}
+
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	current, err := json.Marshal(models.UpdateProductPayload{
+		Name:        product.Name,
+		Description: product.Description,
+		Image:       product.Image,
+		Price:       product.Price,
+		TaxCategory: product.TaxCategory,
+		WeightGrams: product.WeightGrams,
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	patched, err := utils.MergePatch(current, patch)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// A bare amount such as "price": "9.99" replaces the whole price object,
+	// so it is read in the product's current currency rather than the default.
+	payload := models.UpdateProductPayload{Price: money.Zero(product.Price.Currency)}
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid patch: %v", err))
+		return
+	}
+
+	h.saveProduct(w, product, payload)
+}
+
+func (h *Handler) handleDeleteProduct(w http.ResponseWriter, r *http.Request) {
+	product, ok := h.getProduct(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.DeleteProduct(product.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// saveProduct validates payload and writes it over product.
+func (h *Handler) saveProduct(w http.ResponseWriter, product *models.Product, payload models.UpdateProductPayload) {
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return
+	}
+
+	if !payload.Price.IsPositive() {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: price must be positive"))
+		return
+	}
+
+	if err := validatePriceList(payload.Price.Currency, product.Prices); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	product.Name = payload.Name
+	product.Description = payload.Description
+	product.Image = payload.Image
+	product.Price = payload.Price
+	product.TaxCategory = payload.TaxCategory
+	product.WeightGrams = payload.WeightGrams
+
+	if err := h.store.UpdateProduct(*product); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, product)
+}
+
+// getProduct loads the product named in the URL, writing a 404 for unknown
+// or deleted products.
+func (h *Handler) getProduct(w http.ResponseWriter, r *http.Request) (*models.Product, bool) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["productID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid product ID"))
+		return nil, false
+	}
+
+	product, err := h.store.GetProductByID(productID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if product == nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("product not found"))
+		return nil, false
+	}
+
+	return product, true
+}
+
+func (h *Handler) handleSetProductPrices(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["productID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid product ID"))
+		return
+	}
+
+	var payload models.SetProductPricesPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	product, err := h.store.GetProductByID(productID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if product == nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("product not found"))
+		return
+	}
+
+	if err := validatePriceList(product.Price.Currency, payload.Prices); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.store.SetProductPrices(productID, payload.Prices); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	product.Prices = payload.Prices
+	utils.WriteJSON(w, http.StatusOK, product)
+}
+
+func (h *Handler) handleGetStockHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["productID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid product ID"))
+		return
+	}
+
+	product, err := h.store.GetProductByID(productID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if product == nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("product not found"))
+		return
+	}
+
+	movements, err := h.inventoryStore.GetStockMovements(productID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	ledgerQuantity, err := h.inventoryStore.GetLedgerQuantity(productID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, models.StockHistoryResponse{
+		ProductID:      productID,
+		Quantity:       product.Quantity,
+		LedgerQuantity: ledgerQuantity,
+		Movements:      movements,
+	})
+}
+
+// handleAdjustStock books a manual stock change: a correction after a count,
+// a delivery from a supplier or a customer return.
+func (h *Handler) handleAdjustStock(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["productID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid product ID"))
+		return
+	}
+
+	var payload models.StockAdjustmentPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return
+	}
+
+	product, err := h.store.GetProductByID(productID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if product == nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("product not found"))
+		return
+	}
+
+	movement, err := h.inventoryStore.MoveStock(models.StockMovement{
+		ProductID: productID,
+		Delta:     payload.Delta,
+		Reason:    payload.Reason,
+		ActorID:   &userID,
+		Reference: payload.Reference,
+		Note:      payload.Note,
+	})
+	if errors.Is(err, inventory.ErrInsufficientStock) {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, movement)
+}
+
+// parseProductFilter reads ?limit=&cursor=&sort=price|-price|name|created_at
+// &min_price=&max_price=&currency=&in_stock=true. A leading "-" sorts
+// descending.
+func parseProductFilter(r *http.Request) (models.ProductFilter, error) {
+	query := r.URL.Query()
+	filter := models.ProductFilter{
+		Sort:     SortCreatedAt,
+		Cursor:   query.Get("cursor"),
+		Limit:    defaultPageLimit,
+		Currency: strings.ToUpper(query.Get("currency")),
+	}
+	if filter.Currency == "" {
+		filter.Currency = money.DefaultCurrency
+	}
+
+	if str := query.Get("sort"); str != "" {
+		filter.Descending = strings.HasPrefix(str, "-")
+		filter.Sort = strings.TrimPrefix(str, "-")
+		if filter.Sort != SortCreatedAt && filter.Sort != SortPrice && filter.Sort != SortName {
+			return filter, fmt.Errorf("sort must be one of %s, %s or %s", SortCreatedAt, SortPrice, SortName)
+		}
+	}
+
+	if str := query.Get("limit"); str != "" {
+		limit, err := strconv.Atoi(str)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+		filter.Limit = limit
+	}
+
+	if str := query.Get("min_price"); str != "" {
+		price, err := money.Parse(str, filter.Currency)
+		if err != nil {
+			return filter, fmt.Errorf("invalid min_price")
+		}
+		filter.MinPrice = &price
+	}
+
+	if str := query.Get("max_price"); str != "" {
+		price, err := money.Parse(str, filter.Currency)
+		if err != nil {
+			return filter, fmt.Errorf("invalid max_price")
+		}
+		filter.MaxPrice = &price
+	}
+
+	if str := query.Get("in_stock"); str != "" {
+		inStock, err := strconv.ParseBool(str)
+		if err != nil {
+			return filter, fmt.Errorf("invalid in_stock")
+		}
+		filter.InStock = inStock
+	}
+
+	return filter, nil
+}
+
+// validatePriceList rejects non-positive prices, duplicate currencies and
+// entries in the product's base currency, which is priced by Price itself.
+func validatePriceList(baseCurrency string, prices []money.Money) error {
+	seen := make(map[string]bool)
+	for _, price := range prices {
+		if len(price.Currency) != 3 {
+			return fmt.Errorf("invalid currency %q", price.Currency)
+		}
+		if !price.IsPositive() {
+			return fmt.Errorf("price in %s must be positive", price.Currency)
+		}
+		if price.Currency == baseCurrency {
+			return fmt.Errorf("price list must not contain the base currency %s", baseCurrency)
+		}
+		if seen[price.Currency] {
+			return fmt.Errorf("duplicate price for %s", price.Currency)
+		}
+		seen[price.Currency] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package product
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/mikeudacha/paybuy/models"
+	"github.com/mikeudacha/paybuy/money"
+)
+
+// productStore keeps a single product in memory. Other ProductStore methods
+// are not used by the handlers under test.
+type productStore struct {
+	models.ProductStore
+	product models.Product
+}
+
+func (s *productStore) GetProductByID(id int) (*models.Product, error) {
+	if id != s.product.ID {
+		return nil, nil
+	}
+	p := s.product
+	return &p, nil
+}
+
+func (s *productStore) UpdateProduct(p models.Product) error {
+	s.product = p
+	return nil
+}
+
+func (s *productStore) CreateProduct(p models.CreateProductPayload, actorID int) error {
+	s.product = models.Product{Name: p.Name, Price: p.Price, Quantity: p.Quantity}
+	return nil
+}
+
+func TestCreateProductQuantity(t *testing.T) {
+	tests := []struct {
+		name     string
+		quantity string
+		want     int
+	}{
+		{name: "negative", quantity: "-1", want: http.StatusBadRequest},
+		{name: "zero", quantity: "0", want: http.StatusCreated},
+		{name: "positive", quantity: "5", want: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		store := &productStore{}
+		h := NewHandler(store, nil, nil, nil, nil)
+
+		body := `{"name":"Tea","price":"9.99","quantity":` + tt.quantity + `}`
+		req := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		h.handleCreateProduct(rr, req)
+
+		if rr.Code != tt.want {
+			t.Errorf("%s quantity: status = %d, want %d: %s", tt.name, rr.Code, tt.want, rr.Body)
+		}
+	}
+}
+
+func TestUpdateProductKeepsCurrencyOfBarePrice(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		body    string
+		handler func(h *Handler) http.HandlerFunc
+	}{
+		{
+			name:    "PUT",
+			method:  http.MethodPut,
+			body:    `{"name":"Tea","price":"1500","taxCategory":"standard"}`,
+			handler: func(h *Handler) http.HandlerFunc { return h.handleUpdateProduct },
+		},
+		{
+			name:    "PATCH",
+			method:  http.MethodPatch,
+			body:    `{"price":"1500"}`,
+			handler: func(h *Handler) http.HandlerFunc { return h.handlePatchProduct },
+		},
+	}
+
+	for _, tt := range tests {
+		store := &productStore{product: models.Product{
+			ID:          1,
+			Name:        "Tea",
+			Price:       money.New(1200, "JPY"),
+			TaxCategory: "standard",
+		}}
+		h := NewHandler(store, nil, nil, nil, nil)
+
+		req := httptest.NewRequest(tt.method, "/products/1", strings.NewReader(tt.body))
+		req = mux.SetURLVars(req, map[string]string{"productID": "1"})
+		rr := httptest.NewRecorder()
+		tt.handler(h)(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, rr.Code, http.StatusOK, rr.Body)
+			continue
+		}
+		if want := money.New(1500, "JPY"); store.product.Price != want {
+			t.Errorf("%s: price = %+v, want %+v", tt.name, store.product.Price, want)
+		}
+	}
+}
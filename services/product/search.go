@@ -0,0 +1,124 @@
+package product
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/mikeudacha/paybuy/models"
+)
+
+const (
+	searchConfig = "english"
+
+	nameHeadlineOptions    = "HighlightAll=true, StartSel=<mark>, StopSel=</mark>"
+	snippetHeadlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=2"
+)
+
+// PrefixQuery turns free text into a to_tsquery expression that requires
+// every word, matching the last one as a prefix so partially typed words
+// already find results. Anything but letters and digits is dropped, so user
+// input cannot inject tsquery operators. It returns "" when nothing
+// searchable is left.
+func PrefixQuery(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return ""
+	}
+
+	words[len(words)-1] += ":*"
+	return strings.Join(words, " & ")
+}
+
+// SearchProducts ranks products whose name or description match the query,
+// name matches weighing more, and pages through them by (rank, id).
+func (s *Store) SearchProducts(filter models.ProductSearchFilter) ([]models.ProductSearchResult, string, int, error) {
+	ctx := context.Background()
+
+	conditions := []string{"deleted_at IS NULL", "search_vector @@ to_tsquery('" + searchConfig + "', $1)"}
+	args := []any{filter.Query}
+
+	if filter.InStock {
+		conditions = append(conditions, `quantity > `+reservedQuantity)
+	}
+
+	var total int
+	query := `SELECT COUNT(*) FROM products WHERE ` + strings.Join(conditions, " AND ")
+	if err := s.pool.QueryRow(ctx, query, args...).Scan(&total); err != nil {
+		return nil, "", 0, err
+	}
+
+	cursorCondition := "TRUE"
+	if filter.Cursor != "" {
+		c, err := decodeCursor(filter.Cursor, SortRank, true)
+		if err != nil {
+			return nil, "", 0, err
+		}
+		args = append(args, c.Value, c.ID)
+		cursorCondition = fmt.Sprintf("(rank, id) < ($%d::real, $%d)", len(args)-1, len(args))
+	}
+
+	// The ranked rows are aliased back to products so productColumns can
+	// refer to products.id.
+	args = append(args, filter.Limit+1)
+	query = fmt.Sprintf(`
+		WITH q AS (
+			SELECT to_tsquery('%[1]s', $1) AS query
+		), ranked AS (
+			SELECT products.*, ts_rank_cd(search_vector, q.query)::real AS rank
+			FROM products, q
+			WHERE %[2]s
+		)
+		SELECT %[3]s, rank,
+			ts_headline('%[1]s', name, q.query, '%[4]s'),
+			ts_headline('%[1]s', description, q.query, '%[5]s')
+		FROM ranked products, q
+		WHERE %[6]s
+		ORDER BY rank DESC, id DESC
+		LIMIT $%[7]d
+	`, searchConfig, strings.Join(conditions, " AND "), productColumns,
+		nameHeadlineOptions, snippetHeadlineOptions, cursorCondition, len(args))
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	defer rows.Close()
+
+	results := make([]models.ProductSearchResult, 0)
+	ids := make([]int, 0)
+	for rows.Next() {
+		var result models.ProductSearchResult
+		p, err := scanRowsIntoProduct(rows, &result.Rank, &result.NameHighlight, &result.Snippet)
+		if err != nil {
+			return nil, "", 0, err
+		}
+		result.Product = *p
+		results = append(results, result)
+		ids = append(ids, p.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", 0, err
+	}
+	rows.Close()
+
+	nextCursor := ""
+	if len(results) > filter.Limit {
+		results = results[:filter.Limit]
+		ids = ids[:filter.Limit]
+		nextCursor = searchCursor(results[len(results)-1]).encode()
+	}
+
+	prices, err := getProductPrices(s.pool, ids)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	for i := range results {
+		results[i].Prices = prices[results[i].ID]
+	}
+
+	return results, nextCursor, total, nil
+}
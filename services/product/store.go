@@ -3,87 +3,271 @@ package product
 import (
 	"context"
 	"fmt"
+	"strings"
+
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mikeudacha/paybuy/db"
 	"github.com/mikeudacha/paybuy/models"
-	"strings"
+	"github.com/mikeudacha/paybuy/money"
+	"github.com/mikeudacha/paybuy/services/inventory"
 )
 
+// reservedQuantity is the product's actively reserved stock.
+const reservedQuantity = `COALESCE((
+	SELECT SUM(r.quantity) FROM stock_reservations r WHERE r.product_id = products.id AND r.status = 'active'
+), 0)`
+
+// productColumns selects a product row together with its available stock:
+// on-hand quantity minus active reservations.
+const productColumns = `id, name, description, image, price, currency, quantity,
+	quantity - ` + reservedQuantity + ` AS available,
+	tax_category, weight_grams, created_at`
+
 type Store struct {
-	pool *pgxpool.Pool
+	pool      *pgxpool.Pool
+	inventory models.InventoryStore
 }
 
-func NewStore(pool *pgxpool.Pool) *Store {
-	return &Store{pool: pool}
+func NewStore(pool *pgxpool.Pool, inventory models.InventoryStore) *Store {
+	return &Store{pool: pool, inventory: inventory}
 }
 
-func (s *Store) GetProducts() ([]*models.Product, error) {
-	query := `SELECT * FROM products`
-	rows, err := s.pool.Query(context.Background(), query)
+// GetProducts pages through products with keyset pagination: each page
+// continues after the (sort value, id) of the previous page's last row, so
+// pages stay stable while products are added. Price sorting and filtering use
+// the base price; a price range also matches a price-list entry in the
+// requested currency.
+func (s *Store) GetProducts(filter models.ProductFilter) ([]*models.Product, string, int, error) {
+	ctx := context.Background()
+
+	conditions := []string{"deleted_at IS NULL"}
+	args := []any{}
+
+	if filter.MinPrice != nil || filter.MaxPrice != nil {
+		args = append(args, filter.Currency)
+		currencyArg := len(args)
+
+		bounds := []string{}
+		if filter.MinPrice != nil {
+			args = append(args, *filter.MinPrice)
+			bounds = append(bounds, fmt.Sprintf("%%[1]s >= $%d", len(args)))
+		}
+		if filter.MaxPrice != nil {
+			args = append(args, *filter.MaxPrice)
+			bounds = append(bounds, fmt.Sprintf("%%[1]s <= $%d", len(args)))
+		}
+		// priceRange applies the bounds to the given price column.
+		priceRange := func(column string) string {
+			return fmt.Sprintf(strings.Join(bounds, " AND "), column)
+		}
+
+		conditions = append(conditions, fmt.Sprintf(`(
+			(currency = $%d AND %s)
+			OR EXISTS (SELECT 1 FROM product_prices pp WHERE pp.product_id = products.id AND pp.currency = $%d AND %s)
+		)`, currencyArg, priceRange("price"), currencyArg, priceRange("pp.price")))
+	}
+
+	if filter.InStock {
+		conditions = append(conditions, `quantity > `+reservedQuantity)
+	}
+
+	var total int
+	query := `SELECT COUNT(*) FROM products WHERE ` + strings.Join(conditions, " AND ")
+	if err := s.pool.QueryRow(ctx, query, args...).Scan(&total); err != nil {
+		return nil, "", 0, err
+	}
+
+	column, cast := "created_at", "timestamp"
+	switch filter.Sort {
+	case SortPrice:
+		column, cast = "price", "numeric"
+	case SortName:
+		column, cast = "name", "text"
+	}
+	direction, comparison := "ASC", ">"
+	if filter.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	if filter.Cursor != "" {
+		c, err := decodeCursor(filter.Cursor, filter.Sort, filter.Descending)
+		if err != nil {
+			return nil, "", 0, err
+		}
+		args = append(args, c.Value, c.ID)
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s ($%d::%s, $%d)", column, comparison, len(args)-1, cast, len(args)))
+	}
+
+	// Fetch one extra row to learn whether there is a next page.
+	args = append(args, filter.Limit+1)
+	query = fmt.Sprintf(`SELECT %s FROM products WHERE %s ORDER BY %s %s, id %s LIMIT $%d`,
+		productColumns, strings.Join(conditions, " AND "), column, direction, direction, len(args))
+
+	rows, err := s.pool.Query(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, "", 0, err
 	}
+	defer rows.Close()
+
 	products := make([]*models.Product, 0)
+	ids := make([]int, 0)
 	for rows.Next() {
 		p, err := scanRowsIntoProduct(rows)
 		if err != nil {
-			return nil, err
+			return nil, "", 0, err
 		}
 		products = append(products, p)
+		ids = append(ids, p.ID)
 	}
-	return products, nil
+	if err := rows.Err(); err != nil {
+		return nil, "", 0, err
+	}
+	rows.Close()
+
+	nextCursor := ""
+	if len(products) > filter.Limit {
+		products = products[:filter.Limit]
+		ids = ids[:filter.Limit]
+		nextCursor = listCursor(filter, products[len(products)-1]).encode()
+	}
+
+	prices, err := getProductPrices(s.pool, ids)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	for _, p := range products {
+		p.Prices = prices[p.ID]
+	}
+
+	return products, nextCursor, total, nil
 }
 
-func (s *Store) CreateProduct(product models.CreateProductPayload) error {
-	query := `INSERT INTO products (name, price, image, description, quantity) VALUES($1, $2, $3, $4, $5)`
-	_, err := s.pool.Exec(context.Background(), query, product.Name, product.Price, product.Image, product.Description, product.Quantity)
+// CreateProduct inserts the product with no stock and books its initial
+// quantity through the stock ledger.
+func (s *Store) CreateProduct(product models.CreateProductPayload, actorID int) error {
+	ctx := context.Background()
+
+	tx, err := s.pool.Begin(ctx)
 	if err != nil {
 		return err
 	}
-	return nil
+	defer tx.Rollback(ctx)
+
+	var id int
+	query := `INSERT INTO products (name, price, currency, image, description, quantity, tax_category, weight_grams) VALUES($1, $2, $3, $4, $5, 0, $6, $7) RETURNING id`
+	err = tx.QueryRow(ctx, query,
+		product.Name,
+		product.Price,
+		product.Price.Currency,
+		product.Image,
+		product.Description,
+		product.TaxCategory,
+		product.WeightGrams,
+	).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	if err := setProductPrices(tx, id, product.Prices); err != nil {
+		return err
+	}
+
+	if product.Quantity != 0 {
+		_, err := s.inventory.MoveStockTx(tx, models.StockMovement{
+			ProductID: id,
+			Delta:     product.Quantity,
+			Reason:    inventory.ReasonInitial,
+			ActorID:   &actorID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
 }
 
 func (s *Store) GetProductByID(productID int) (*models.Product, error) {
-	query := `SELECT * FROM products WHERE id = $1`
-	rows, err := s.pool.Query(context.Background(), query, productID)
+	products, err := getProductsByID(s.pool, `SELECT `+productColumns+` FROM products WHERE id = ANY($1) AND deleted_at IS NULL`, []int{productID})
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	if rows.Next() {
-		return scanRowsIntoProduct(rows)
+	if len(products) == 0 {
+		return nil, nil
 	}
 
-	return nil, nil
+	return &products[0], nil
 }
+
+// SetProductPrices replaces the product's per-currency price list.
+func (s *Store) SetProductPrices(productID int, prices []money.Money) error {
+	ctx := context.Background()
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := setProductPrices(tx, productID, prices); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
 func (s *Store) UpdateProduct(product models.Product) error {
-	query := `UPDATE products SET name = $1,price = $2,image = $3,description = $4,quantity = $5 WHERE id = $6`
-	_, err := s.pool.Exec(context.Background(), query,
+	return updateProduct(s.pool, product)
+}
+
+// DeleteProduct hides the product from the catalogue and checkout. The row is
+// kept so order items, price lists and the stock ledger still resolve.
+func (s *Store) DeleteProduct(productID int) error {
+	query := `UPDATE products SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NULL`
+	_, err := s.pool.Exec(context.Background(), query, productID)
+	return err
+}
+
+func (s *Store) UpdateProductTx(tx pgx.Tx, product models.Product) error {
+	return updateProduct(tx, product)
+}
+
+func (s *Store) GetProductsByID(productIDs []int) ([]models.Product, error) {
+	return getProductsByID(s.pool, `SELECT `+productColumns+` FROM products WHERE id = ANY($1) AND deleted_at IS NULL`, productIDs)
+}
+
+// GetProductsByIDForUpdate locks the selected rows until tx finishes. Rows
+// are locked in id order so concurrent checkouts cannot deadlock.
+func (s *Store) GetProductsByIDForUpdate(tx pgx.Tx, productIDs []int) ([]models.Product, error) {
+	return getProductsByID(tx, `SELECT `+productColumns+` FROM products WHERE id = ANY($1) AND deleted_at IS NULL ORDER BY id FOR UPDATE OF products`, productIDs)
+}
+
+// updateProduct writes everything but the quantity, which only changes
+// through the stock ledger. Deleted products are left untouched.
+func updateProduct(q db.Querier, product models.Product) error {
+	query := `UPDATE products SET name = $1,price = $2,currency = $3,image = $4,description = $5,tax_category = $6,weight_grams = $7 WHERE id = $8 AND deleted_at IS NULL`
+	_, err := q.Exec(context.Background(), query,
 		product.Name,
 		product.Price,
+		product.Price.Currency,
 		product.Image,
 		product.Description,
-		product.Quantity,
+		product.TaxCategory,
+		product.WeightGrams,
 		product.ID,
 	)
 
 	return err
 }
 
-func (s *Store) GetProductsByID(productIDs []int) ([]models.Product, error) {
+func getProductsByID(q db.Querier, query string, productIDs []int) ([]models.Product, error) {
 	if len(productIDs) == 0 {
 		return []models.Product{}, nil
 	}
-	placeholders := strings.Repeat(",$", len(productIDs))
-	query := fmt.Sprintf("SELECT * FROM products WHERE id IN ($1,%s)", placeholders)
 
-	args := make([]interface{}, len(productIDs))
-	for i, v := range productIDs {
-		args[i] = v
-	}
-
-	rows, err := s.pool.Query(context.Background(), query, args...)
+	rows, err := q.Query(context.Background(), query, productIDs)
 	if err != nil {
 		return nil, err
 	}
@@ -97,25 +281,88 @@ func (s *Store) GetProductsByID(productIDs []int) ([]models.Product, error) {
 		}
 		products = append(products, *p)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	prices, err := getProductPrices(q, productIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range products {
+		products[i].Prices = prices[products[i].ID]
+	}
 
 	return products, nil
 }
 
-func scanRowsIntoProduct(rows pgx.Rows) (*models.Product, error) {
+func getProductPrices(q db.Querier, productIDs []int) (map[int][]money.Money, error) {
+	prices := make(map[int][]money.Money)
+	if len(productIDs) == 0 {
+		return prices, nil
+	}
+
+	query := `SELECT product_id, price, currency FROM product_prices WHERE product_id = ANY($1) ORDER BY product_id, currency`
+	rows, err := q.Query(context.Background(), query, productIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID int
+		var price money.Money
+		var currency string
+		if err := rows.Scan(&productID, &price, &currency); err != nil {
+			return nil, err
+		}
+		prices[productID] = append(prices[productID], price.WithCurrency(currency))
+	}
+
+	return prices, rows.Err()
+}
+
+func setProductPrices(q db.Querier, productID int, prices []money.Money) error {
+	ctx := context.Background()
+
+	if _, err := q.Exec(ctx, `DELETE FROM product_prices WHERE product_id = $1`, productID); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO product_prices (product_id, currency, price) VALUES ($1, $2, $3)`
+	for _, price := range prices {
+		if _, err := q.Exec(ctx, query, productID, price.Currency, price); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scanRowsIntoProduct scans productColumns, followed by any extra columns the
+// query selects into extra.
+func scanRowsIntoProduct(rows pgx.Rows, extra ...any) (*models.Product, error) {
 	product := new(models.Product)
 
-	err := rows.Scan(
+	var currency string
+	dest := []any{
 		&product.ID,
 		&product.Name,
 		&product.Description,
 		&product.Image,
 		&product.Price,
+		&currency,
 		&product.Quantity,
+		&product.Available,
+		&product.TaxCategory,
+		&product.WeightGrams,
 		&product.CreatedAt,
-	)
-	if err != nil {
+	}
+	if err := rows.Scan(append(dest, extra...)...); err != nil {
 		return nil, err
 	}
+	product.Price = product.Price.WithCurrency(currency)
 
 	return product, nil
 }
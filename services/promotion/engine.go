@@ -0,0 +1,177 @@
+package promotion
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mikeudacha/paybuy/models"
+	"github.com/mikeudacha/paybuy/money"
+	"github.com/mikeudacha/paybuy/services/exchange"
+)
+
+const (
+	TypePercentage   = "percentage"
+	TypeFixedAmount  = "fixed_amount"
+	TypeFreeShipping = "free_shipping"
+	TypeBuyXGetY     = "buy_x_get_y"
+)
+
+var ErrCouponNotApplicable = errors.New("coupon cannot be applied")
+
+// Line is one priced checkout line the engine can discount.
+type Line struct {
+	ProductID int
+	Quantity  int
+	UnitPrice money.Money
+}
+
+// Apply checks the coupon's validity window and minimum order value and
+// computes the discount it gives on lines. Usage limits depend on stored
+// redemptions and are checked by the caller. Coupon amounts are converted to
+// the currency of subtotal when they differ.
+func Apply(coupon models.Coupon, lines []Line, subtotal money.Money, rates exchange.RateProvider, now time.Time) (*models.OrderDiscount, error) {
+	if coupon.StartsAt != nil && now.Before(*coupon.StartsAt) {
+		return nil, fmt.Errorf("%w: coupon %s is not active yet", ErrCouponNotApplicable, coupon.Code)
+	}
+	if coupon.EndsAt != nil && !now.Before(*coupon.EndsAt) {
+		return nil, fmt.Errorf("%w: coupon %s has expired", ErrCouponNotApplicable, coupon.Code)
+	}
+
+	if coupon.MinOrderValue != nil {
+		minimum, err := exchange.Convert(rates, *coupon.MinOrderValue, subtotal.Currency)
+		if err != nil {
+			return nil, err
+		}
+		if subtotal.Cmp(minimum) < 0 {
+			return nil, fmt.Errorf("%w: order total must be at least %s %s", ErrCouponNotApplicable, minimum, minimum.Currency)
+		}
+	}
+
+	discount := &models.OrderDiscount{
+		CouponID:   coupon.ID,
+		CouponCode: coupon.Code,
+		Type:       coupon.Type,
+		Amount:     money.Zero(subtotal.Currency),
+	}
+
+	switch coupon.Type {
+	case TypePercentage:
+		if coupon.Percent == nil {
+			return nil, fmt.Errorf("coupon %s has no percent", coupon.Code)
+		}
+		discount.Amount = subtotal.MulRat(big.NewRat(int64(*coupon.Percent), 100))
+		discount.Description = fmt.Sprintf("%d%% off", *coupon.Percent)
+
+	case TypeFixedAmount:
+		if coupon.Amount == nil {
+			return nil, fmt.Errorf("coupon %s has no amount", coupon.Code)
+		}
+		amount, err := exchange.Convert(rates, *coupon.Amount, subtotal.Currency)
+		if err != nil {
+			return nil, err
+		}
+		if amount.Cmp(subtotal) > 0 {
+			amount = subtotal
+		}
+		discount.Amount = amount
+		discount.Description = fmt.Sprintf("%s %s off", coupon.Amount, coupon.Amount.Currency)
+
+	case TypeFreeShipping:
+		discount.FreeShipping = true
+		discount.Description = "free shipping"
+
+	case TypeBuyXGetY:
+		if coupon.ProductID == nil || coupon.BuyQuantity == nil || coupon.GetQuantity == nil {
+			return nil, fmt.Errorf("coupon %s is missing its buy/get rule", coupon.Code)
+		}
+		buy, get := *coupon.BuyQuantity, *coupon.GetQuantity
+
+		free := 0
+		unitPrice := money.Zero(subtotal.Currency)
+		for _, line := range lines {
+			if line.ProductID == *coupon.ProductID {
+				free += line.Quantity
+				unitPrice = line.UnitPrice
+			}
+		}
+		free = free / (buy + get) * get
+		if free == 0 {
+			return nil, fmt.Errorf("%w: buy %d of product %d to get %d free", ErrCouponNotApplicable, buy+get, *coupon.ProductID, get)
+		}
+
+		discount.Amount = unitPrice.Mul(free)
+		discount.Description = fmt.Sprintf("buy %d get %d free", buy, get)
+
+	default:
+		return nil, fmt.Errorf("unknown coupon type %q", coupon.Type)
+	}
+
+	return discount, nil
+}
+
+// ValidateCoupon checks that the fields required by the coupon type are set.
+func ValidateCoupon(payload models.CreateCouponPayload) error {
+	switch payload.Type {
+	case TypePercentage:
+		if payload.Percent == nil {
+			return fmt.Errorf("percentage coupons require percent")
+		}
+	case TypeFixedAmount:
+		if payload.Amount == nil || !payload.Amount.IsPositive() {
+			return fmt.Errorf("fixed amount coupons require a positive amount")
+		}
+	case TypeBuyXGetY:
+		if payload.ProductID == nil || payload.BuyQuantity == nil || payload.GetQuantity == nil {
+			return fmt.Errorf("buy x get y coupons require productID, buyQuantity and getQuantity")
+		}
+	}
+
+	if payload.MinOrderValue != nil && payload.MinOrderValue.IsNegative() {
+		return fmt.Errorf("minOrderValue must not be negative")
+	}
+	if payload.Amount != nil && payload.MinOrderValue != nil && payload.Amount.Currency != payload.MinOrderValue.Currency {
+		return fmt.Errorf("amount and minOrderValue must use the same currency")
+	}
+	if payload.StartsAt != nil && payload.EndsAt != nil && !payload.EndsAt.After(*payload.StartsAt) {
+		return fmt.Errorf("endsAt must be after startsAt")
+	}
+
+	return nil
+}
+
+// Prepare loads the coupon for code under a row lock, enforces its global and
+// per-user usage limits and computes the discount. The caller records the
+// redemption with RedeemCouponTx once the order exists.
+func Prepare(tx pgx.Tx, store models.CouponStore, code string, userID int, lines []Line, subtotal money.Money, rates exchange.RateProvider) (*models.Coupon, *models.OrderDiscount, error) {
+	coupon, err := store.GetCouponByCodeForUpdate(tx, code)
+	if err != nil {
+		return nil, nil, err
+	}
+	if coupon == nil {
+		return nil, nil, fmt.Errorf("%w: unknown coupon code %s", ErrCouponNotApplicable, code)
+	}
+
+	if coupon.MaxUses != nil && coupon.UsedCount >= *coupon.MaxUses {
+		return nil, nil, fmt.Errorf("%w: coupon %s has been fully redeemed", ErrCouponNotApplicable, coupon.Code)
+	}
+
+	if coupon.MaxUsesPerUser != nil {
+		used, err := store.CountUserRedemptionsTx(tx, coupon.ID, userID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if used >= *coupon.MaxUsesPerUser {
+			return nil, nil, fmt.Errorf("%w: coupon %s has already been used", ErrCouponNotApplicable, coupon.Code)
+		}
+	}
+
+	discount, err := Apply(*coupon, lines, subtotal, rates, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return coupon, discount, nil
+}
@@ -0,0 +1,92 @@
+package promotion
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"github.com/mikeudacha/paybuy/models"
+	"github.com/mikeudacha/paybuy/money"
+	"github.com/mikeudacha/paybuy/services/auth"
+	"github.com/mikeudacha/paybuy/utils"
+)
+
+type Handler struct {
+	store          models.CouponStore
+	userStore      models.UserStore
+	blacklistStore *auth.BlacklistStore
+}
+
+func NewHandler(store models.CouponStore, userStore models.UserStore, blacklistStore *auth.BlacklistStore) *Handler {
+	return &Handler{
+		store:          store,
+		userStore:      userStore,
+		blacklistStore: blacklistStore,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/coupons", auth.WithJWTAuth(auth.RequireRole(h.handleGetCoupons, auth.RoleStaff), h.userStore, h.blacklistStore)).Methods(http.MethodGet)
+	router.HandleFunc("/coupons", auth.WithJWTAuth(auth.RequireRole(h.handleCreateCoupon, auth.RoleStaff), h.userStore, h.blacklistStore)).Methods(http.MethodPost)
+}
+
+func (h *Handler) handleGetCoupons(w http.ResponseWriter, r *http.Request) {
+	coupons, err := h.store.GetCoupons()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, coupons)
+}
+
+func (h *Handler) handleCreateCoupon(w http.ResponseWriter, r *http.Request) {
+	var payload models.CreateCouponPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return
+	}
+
+	if err := ValidateCoupon(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", err))
+		return
+	}
+
+	coupon := models.Coupon{
+		Code:           strings.ToUpper(payload.Code),
+		Type:           payload.Type,
+		Percent:        payload.Percent,
+		Amount:         payload.Amount,
+		Currency:       money.DefaultCurrency,
+		ProductID:      payload.ProductID,
+		BuyQuantity:    payload.BuyQuantity,
+		GetQuantity:    payload.GetQuantity,
+		MinOrderValue:  payload.MinOrderValue,
+		StartsAt:       payload.StartsAt,
+		EndsAt:         payload.EndsAt,
+		MaxUses:        payload.MaxUses,
+		MaxUsesPerUser: payload.MaxUsesPerUser,
+	}
+	if payload.Amount != nil {
+		coupon.Currency = payload.Amount.Currency
+	} else if payload.MinOrderValue != nil {
+		coupon.Currency = payload.MinOrderValue.Currency
+	}
+
+	id, err := h.store.CreateCoupon(coupon)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	coupon.ID = id
+
+	utils.WriteJSON(w, http.StatusCreated, coupon)
+}
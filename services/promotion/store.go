@@ -0,0 +1,155 @@
+package promotion
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mikeudacha/paybuy/models"
+)
+
+const couponColumns = `id, code, type, percent, amount, currency, product_id, buy_quantity, get_quantity,
+	min_order_value, starts_at, ends_at, max_uses, max_uses_per_user, used_count, created_at`
+
+type Store struct {
+	pool *pgxpool.Pool
+}
+
+func NewStore(pool *pgxpool.Pool) *Store {
+	return &Store{pool: pool}
+}
+
+func (s *Store) CreateCoupon(coupon models.Coupon) (int, error) {
+	var id int
+	query := `
+		INSERT INTO coupons (code, type, percent, amount, currency, product_id, buy_quantity, get_quantity,
+			min_order_value, starts_at, ends_at, max_uses, max_uses_per_user)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id
+	`
+	err := s.pool.QueryRow(context.Background(), query,
+		strings.ToUpper(coupon.Code),
+		coupon.Type,
+		coupon.Percent,
+		coupon.Amount,
+		coupon.Currency,
+		coupon.ProductID,
+		coupon.BuyQuantity,
+		coupon.GetQuantity,
+		coupon.MinOrderValue,
+		coupon.StartsAt,
+		coupon.EndsAt,
+		coupon.MaxUses,
+		coupon.MaxUsesPerUser,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *Store) GetCoupons() ([]models.Coupon, error) {
+	rows, err := s.pool.Query(context.Background(), `SELECT `+couponColumns+` FROM coupons ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	coupons := make([]models.Coupon, 0)
+	for rows.Next() {
+		c, err := scanRowsIntoCoupon(rows)
+		if err != nil {
+			return nil, err
+		}
+		coupons = append(coupons, *c)
+	}
+
+	return coupons, rows.Err()
+}
+
+// GetCouponByCodeForUpdate locks the coupon so concurrent checkouts cannot
+// exceed its usage limits. It returns nil when the code does not exist.
+func (s *Store) GetCouponByCodeForUpdate(tx pgx.Tx, code string) (*models.Coupon, error) {
+	query := `SELECT ` + couponColumns + ` FROM coupons WHERE code = $1 FOR UPDATE`
+	rows, err := tx.Query(context.Background(), query, strings.ToUpper(code))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		return scanRowsIntoCoupon(rows)
+	}
+
+	return nil, rows.Err()
+}
+
+func (s *Store) CountUserRedemptionsTx(tx pgx.Tx, couponID, userID int) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM coupon_redemptions WHERE coupon_id = $1 AND user_id = $2`
+	err := tx.QueryRow(context.Background(), query, couponID, userID).Scan(&count)
+	return count, err
+}
+
+func (s *Store) RedeemCouponTx(tx pgx.Tx, couponID, userID, orderID int) error {
+	ctx := context.Background()
+
+	query := `INSERT INTO coupon_redemptions (coupon_id, user_id, order_id) VALUES ($1, $2, $3)`
+	if _, err := tx.Exec(ctx, query, couponID, userID, orderID); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(ctx, `UPDATE coupons SET used_count = used_count + 1 WHERE id = $1`, couponID)
+	return err
+}
+
+// ReleaseRedemptionsTx gives back the coupon uses recorded for orderID so a
+// cancelled order does not count against the coupon's or the user's limit.
+func (s *Store) ReleaseRedemptionsTx(tx pgx.Tx, orderID int) error {
+	query := `
+		WITH released AS (
+			DELETE FROM coupon_redemptions WHERE order_id = $1 RETURNING coupon_id
+		)
+		UPDATE coupons c SET used_count = c.used_count - r.n
+		FROM (SELECT coupon_id, COUNT(*) AS n FROM released GROUP BY coupon_id) r
+		WHERE c.id = r.coupon_id
+	`
+	_, err := tx.Exec(context.Background(), query, orderID)
+	return err
+}
+
+func scanRowsIntoCoupon(rows pgx.Rows) (*models.Coupon, error) {
+	coupon := new(models.Coupon)
+
+	err := rows.Scan(
+		&coupon.ID,
+		&coupon.Code,
+		&coupon.Type,
+		&coupon.Percent,
+		&coupon.Amount,
+		&coupon.Currency,
+		&coupon.ProductID,
+		&coupon.BuyQuantity,
+		&coupon.GetQuantity,
+		&coupon.MinOrderValue,
+		&coupon.StartsAt,
+		&coupon.EndsAt,
+		&coupon.MaxUses,
+		&coupon.MaxUsesPerUser,
+		&coupon.UsedCount,
+		&coupon.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if coupon.Amount != nil {
+		*coupon.Amount = coupon.Amount.WithCurrency(coupon.Currency)
+	}
+	if coupon.MinOrderValue != nil {
+		*coupon.MinOrderValue = coupon.MinOrderValue.WithCurrency(coupon.Currency)
+	}
+
+	return coupon, nil
+}
@@ -0,0 +1,130 @@
+package shipping
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/mikeudacha/paybuy/models"
+	"github.com/mikeudacha/paybuy/money"
+	"github.com/mikeudacha/paybuy/services/exchange"
+)
+
+var ErrNoShippingMethod = errors.New("no shipping method available")
+
+// Option is a shipping method offered for a parcel, priced in the order
+// currency.
+type Option struct {
+	Method string      `json:"method"`
+	Price  money.Money `json:"price"`
+}
+
+type RateCalculator interface {
+	// Quote returns the shipping methods available for a parcel of
+	// weightGrams sent to country, cheapest first. subtotal is the
+	// discounted order value, used for the free-shipping threshold.
+	Quote(country string, weightGrams int, subtotal money.Money) ([]Option, error)
+}
+
+// TableCalculator prices parcels from the shipping_zones and shipping_rates
+// tables. For each method of the destination zone it picks the lightest
+// weight band the parcel fits into. Orders at or above the zone's
+// free-shipping threshold ship for free.
+type TableCalculator struct {
+	store models.ShippingStore
+	rates exchange.RateProvider
+}
+
+func NewTableCalculator(store models.ShippingStore, rates exchange.RateProvider) *TableCalculator {
+	return &TableCalculator{store: store, rates: rates}
+}
+
+func (c *TableCalculator) Quote(country string, weightGrams int, subtotal money.Money) ([]Option, error) {
+	zone, err := c.store.GetShippingZoneForCountry(country)
+	if err != nil {
+		return nil, err
+	}
+	if zone == nil {
+		return nil, fmt.Errorf("%w: we do not ship to %s", ErrNoShippingMethod, country)
+	}
+
+	bands, err := c.store.GetShippingRates(zone.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	best := make(map[string]models.ShippingRate)
+	for _, band := range bands {
+		if band.MaxWeightGrams != nil && *band.MaxWeightGrams < weightGrams {
+			continue
+		}
+		current, ok := best[band.Method]
+		if !ok || lighter(band, current) {
+			best[band.Method] = band
+		}
+	}
+	if len(best) == 0 {
+		return nil, fmt.Errorf("%w: parcel of %dg is too heavy for zone %s", ErrNoShippingMethod, weightGrams, zone.Code)
+	}
+
+	free := false
+	if zone.FreeShippingThreshold != nil {
+		threshold, err := exchange.Convert(c.rates, *zone.FreeShippingThreshold, subtotal.Currency)
+		if err != nil {
+			return nil, err
+		}
+		free = subtotal.Cmp(threshold) >= 0
+	}
+
+	options := make([]Option, 0, len(best))
+	for method, band := range best {
+		price := money.Zero(subtotal.Currency)
+		if !free {
+			price, err = exchange.Convert(c.rates, band.Price, subtotal.Currency)
+			if err != nil {
+				return nil, err
+			}
+		}
+		options = append(options, Option{Method: method, Price: price})
+	}
+
+	sort.Slice(options, func(i, j int) bool {
+		if cmp := options[i].Price.Cmp(options[j].Price); cmp != 0 {
+			return cmp < 0
+		}
+		return options[i].Method < options[j].Method
+	})
+
+	return options, nil
+}
+
+// Select returns the option for method, or the cheapest option when method
+// is empty.
+func Select(options []Option, method string) (Option, error) {
+	if len(options) == 0 {
+		return Option{}, ErrNoShippingMethod
+	}
+	if method == "" {
+		return options[0], nil
+	}
+
+	for _, option := range options {
+		if option.Method == method {
+			return option, nil
+		}
+	}
+
+	return Option{}, fmt.Errorf("%w: unknown shipping method %q", ErrNoShippingMethod, method)
+}
+
+// lighter reports whether band a has a lower weight limit than band b, with
+// unlimited bands sorting last.
+func lighter(a, b models.ShippingRate) bool {
+	if a.MaxWeightGrams == nil {
+		return false
+	}
+	if b.MaxWeightGrams == nil {
+		return true
+	}
+	return *a.MaxWeightGrams < *b.MaxWeightGrams
+}
@@ -0,0 +1,175 @@
+package shipping
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"github.com/mikeudacha/paybuy/models"
+	"github.com/mikeudacha/paybuy/money"
+	"github.com/mikeudacha/paybuy/services/auth"
+	"github.com/mikeudacha/paybuy/utils"
+)
+
+type Handler struct {
+	store          models.ShippingStore
+	calculator     RateCalculator
+	userStore      models.UserStore
+	blacklistStore *auth.BlacklistStore
+}
+
+func NewHandler(store models.ShippingStore, calculator RateCalculator, userStore models.UserStore, blacklistStore *auth.BlacklistStore) *Handler {
+	return &Handler{
+		store:          store,
+		calculator:     calculator,
+		userStore:      userStore,
+		blacklistStore: blacklistStore,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/shipping/quote", h.handleQuote).Methods(http.MethodGet)
+
+	router.HandleFunc("/shipping/zones", auth.WithJWTAuth(auth.RequireRole(h.handleGetZones, auth.RoleStaff), h.userStore, h.blacklistStore)).Methods(http.MethodGet)
+	router.HandleFunc("/shipping/zones", auth.WithJWTAuth(auth.RequireRole(h.handleCreateZone, auth.RoleAdmin), h.userStore, h.blacklistStore)).Methods(http.MethodPost)
+	router.HandleFunc("/shipping/zones/{zone}/rates", auth.WithJWTAuth(auth.RequireRole(h.handleGetRates, auth.RoleStaff), h.userStore, h.blacklistStore)).Methods(http.MethodGet)
+	router.HandleFunc("/shipping/rates", auth.WithJWTAuth(auth.RequireRole(h.handleCreateRate, auth.RoleAdmin), h.userStore, h.blacklistStore)).Methods(http.MethodPost)
+}
+
+// handleQuote lists the shipping options for
+// ?country=DE&weight=1200&subtotal=49.90&currency=EUR.
+func (h *Handler) handleQuote(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	country := strings.ToUpper(query.Get("country"))
+	if len(country) != 2 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid country"))
+		return
+	}
+
+	weight, err := strconv.Atoi(query.Get("weight"))
+	if err != nil || weight < 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid weight"))
+		return
+	}
+
+	currency := strings.ToUpper(query.Get("currency"))
+	if currency == "" {
+		currency = money.DefaultCurrency
+	}
+	subtotal := money.Zero(currency)
+	if s := query.Get("subtotal"); s != "" {
+		subtotal, err = money.Parse(s, currency)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid subtotal"))
+			return
+		}
+	}
+
+	options, err := h.calculator.Quote(country, weight, subtotal)
+	if errors.Is(err, ErrNoShippingMethod) {
+		utils.WriteError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, options)
+}
+
+func (h *Handler) handleGetZones(w http.ResponseWriter, r *http.Request) {
+	zones, err := h.store.GetShippingZones()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, zones)
+}
+
+func (h *Handler) handleCreateZone(w http.ResponseWriter, r *http.Request) {
+	var payload models.CreateShippingZonePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return
+	}
+
+	if payload.FreeShippingThreshold != nil && payload.FreeShippingThreshold.IsNegative() {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: freeShippingThreshold must not be negative"))
+		return
+	}
+
+	zone := models.ShippingZone{
+		Code:                  payload.Code,
+		Name:                  payload.Name,
+		Countries:             payload.Countries,
+		FreeShippingThreshold: payload.FreeShippingThreshold,
+	}
+	if zone.Countries == nil {
+		zone.Countries = []string{}
+	}
+
+	if err := h.store.CreateShippingZone(zone); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, zone)
+}
+
+func (h *Handler) handleGetRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := h.store.GetShippingRates(mux.Vars(r)["zone"])
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, rates)
+}
+
+func (h *Handler) handleCreateRate(w http.ResponseWriter, r *http.Request) {
+	var payload models.CreateShippingRatePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return
+	}
+
+	if payload.Price.IsNegative() {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: price must not be negative"))
+		return
+	}
+
+	rate := models.ShippingRate{
+		Zone:           payload.Zone,
+		Method:         payload.Method,
+		MaxWeightGrams: payload.MaxWeightGrams,
+		Price:          payload.Price,
+	}
+
+	id, err := h.store.CreateShippingRate(rate)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	rate.ID = id
+
+	utils.WriteJSON(w, http.StatusCreated, rate)
+}
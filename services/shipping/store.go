@@ -0,0 +1,156 @@
+package shipping
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mikeudacha/paybuy/models"
+	"github.com/mikeudacha/paybuy/money"
+)
+
+const (
+	zoneColumns = `code, name, countries, free_shipping_threshold, currency, created_at`
+	rateColumns = `id, zone, method, max_weight_grams, price, currency, created_at`
+)
+
+type Store struct {
+	pool *pgxpool.Pool
+}
+
+func NewStore(pool *pgxpool.Pool) *Store {
+	return &Store{pool: pool}
+}
+
+func (s *Store) CreateShippingZone(zone models.ShippingZone) error {
+	currency := money.DefaultCurrency
+	if zone.FreeShippingThreshold != nil {
+		currency = zone.FreeShippingThreshold.Currency
+	}
+
+	countries := make([]string, len(zone.Countries))
+	for i, country := range zone.Countries {
+		countries[i] = strings.ToUpper(country)
+	}
+
+	query := `INSERT INTO shipping_zones (code, name, countries, free_shipping_threshold, currency) VALUES ($1, $2, $3, $4, $5)`
+	_, err := s.pool.Exec(context.Background(), query,
+		zone.Code,
+		zone.Name,
+		countries,
+		zone.FreeShippingThreshold,
+		currency,
+	)
+	return err
+}
+
+func (s *Store) GetShippingZones() ([]models.ShippingZone, error) {
+	rows, err := s.pool.Query(context.Background(), `SELECT `+zoneColumns+` FROM shipping_zones ORDER BY code`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	zones := make([]models.ShippingZone, 0)
+	for rows.Next() {
+		zone, err := scanRowsIntoZone(rows)
+		if err != nil {
+			return nil, err
+		}
+		zones = append(zones, *zone)
+	}
+
+	return zones, rows.Err()
+}
+
+func (s *Store) GetShippingZoneForCountry(country string) (*models.ShippingZone, error) {
+	query := `
+		SELECT ` + zoneColumns + `
+		FROM shipping_zones
+		WHERE $1 = ANY(countries) OR cardinality(countries) = 0
+		ORDER BY cardinality(countries) = 0, code
+		LIMIT 1
+	`
+	rows, err := s.pool.Query(context.Background(), query, strings.ToUpper(country))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		return scanRowsIntoZone(rows)
+	}
+
+	return nil, rows.Err()
+}
+
+func (s *Store) CreateShippingRate(rate models.ShippingRate) (int, error) {
+	var id int
+	query := `INSERT INTO shipping_rates (zone, method, max_weight_grams, price, currency) VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	err := s.pool.QueryRow(context.Background(), query,
+		rate.Zone,
+		rate.Method,
+		rate.MaxWeightGrams,
+		rate.Price,
+		rate.Price.Currency,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *Store) GetShippingRates(zone string) ([]models.ShippingRate, error) {
+	query := `SELECT ` + rateColumns + ` FROM shipping_rates WHERE zone = $1 ORDER BY method, max_weight_grams NULLS LAST`
+	rows, err := s.pool.Query(context.Background(), query, zone)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := make([]models.ShippingRate, 0)
+	for rows.Next() {
+		var rate models.ShippingRate
+		var currency string
+		err := rows.Scan(
+			&rate.ID,
+			&rate.Zone,
+			&rate.Method,
+			&rate.MaxWeightGrams,
+			&rate.Price,
+			&currency,
+			&rate.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		rate.Price = rate.Price.WithCurrency(currency)
+		rates = append(rates, rate)
+	}
+
+	return rates, rows.Err()
+}
+
+func scanRowsIntoZone(rows pgx.Rows) (*models.ShippingZone, error) {
+	zone := new(models.ShippingZone)
+
+	var currency string
+	err := rows.Scan(
+		&zone.Code,
+		&zone.Name,
+		&zone.Countries,
+		&zone.FreeShippingThreshold,
+		&currency,
+		&zone.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if zone.FreeShippingThreshold != nil {
+		*zone.FreeShippingThreshold = zone.FreeShippingThreshold.WithCurrency(currency)
+	}
+
+	return zone, nil
+}
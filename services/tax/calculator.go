@@ -0,0 +1,123 @@
+package tax
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/mikeudacha/paybuy/models"
+	"github.com/mikeudacha/paybuy/money"
+)
+
+// DefaultCategory is the tax category of products that do not set one.
+const DefaultCategory = "standard"
+
+// Destination is where an order is shipped, which decides the rules that
+// apply to it.
+type Destination struct {
+	Country string
+	Region  string
+}
+
+// Line is the taxable amount of one order line after discounts.
+type Line struct {
+	ProductID   int
+	TaxCategory string
+	Amount      money.Money
+}
+
+// LineTax is the tax charged on a Line.
+type LineTax struct {
+	ProductID   int
+	TaxCategory string
+	Rate        *big.Rat
+	Amount      money.Money
+}
+
+type TaxCalculator interface {
+	// Calculate returns the tax on each line, in the order of lines.
+	Calculate(dest Destination, lines []Line) ([]LineTax, error)
+}
+
+// RuleTableCalculator looks up rates in the tax_rules table. A rule for the
+// destination region wins over the country-wide rule (empty region) for the
+// same category; lines without a matching rule are not taxed.
+type RuleTableCalculator struct {
+	store models.TaxRuleStore
+}
+
+func NewRuleTableCalculator(store models.TaxRuleStore) *RuleTableCalculator {
+	return &RuleTableCalculator{store: store}
+}
+
+func (c *RuleTableCalculator) Calculate(dest Destination, lines []Line) ([]LineTax, error) {
+	dest.Country = strings.ToUpper(dest.Country)
+	dest.Region = strings.ToUpper(dest.Region)
+
+	rates := make(map[string]*big.Rat)
+	if dest.Country != "" {
+		rules, err := c.store.GetTaxRulesForCountry(dest.Country)
+		if err != nil {
+			return nil, err
+		}
+
+		regional := make(map[string]bool)
+		for _, rule := range rules {
+			region := strings.ToUpper(rule.Region)
+			if region != "" && region != dest.Region {
+				continue
+			}
+			if region == "" && regional[rule.TaxCategory] {
+				continue
+			}
+
+			rate, err := ParseRate(rule.Rate)
+			if err != nil {
+				return nil, fmt.Errorf("tax rule %d: %w", rule.ID, err)
+			}
+			rates[rule.TaxCategory] = rate
+			if region != "" {
+				regional[rule.TaxCategory] = true
+			}
+		}
+	}
+
+	taxes := make([]LineTax, len(lines))
+	for i, line := range lines {
+		category := line.TaxCategory
+		if category == "" {
+			category = DefaultCategory
+		}
+
+		rate, ok := rates[category]
+		if !ok {
+			rate = new(big.Rat)
+		}
+
+		taxes[i] = LineTax{
+			ProductID:   line.ProductID,
+			TaxCategory: category,
+			Rate:        rate,
+			Amount:      line.Amount.MulRat(rate),
+		}
+	}
+
+	return taxes, nil
+}
+
+// ParseRate parses a decimal tax rate such as "0.2" for 20%.
+func ParseRate(s string) (*big.Rat, error) {
+	rate, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("invalid tax rate %q", s)
+	}
+	if rate.Sign() < 0 || rate.Cmp(big.NewRat(1, 1)) >= 0 {
+		return nil, fmt.Errorf("tax rate %q must be between 0 and 1", s)
+	}
+	return rate, nil
+}
+
+// FormatRate formats rate with the precision tax_rules and order_items store.
+func FormatRate(rate *big.Rat) string {
+	return rate.FloatString(6)
+}
@@ -0,0 +1,84 @@
+package tax
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"github.com/mikeudacha/paybuy/models"
+	"github.com/mikeudacha/paybuy/services/auth"
+	"github.com/mikeudacha/paybuy/utils"
+)
+
+type Handler struct {
+	store          models.TaxRuleStore
+	userStore      models.UserStore
+	blacklistStore *auth.BlacklistStore
+}
+
+func NewHandler(store models.TaxRuleStore, userStore models.UserStore, blacklistStore *auth.BlacklistStore) *Handler {
+	return &Handler{
+		store:          store,
+		userStore:      userStore,
+		blacklistStore: blacklistStore,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/tax/rules", auth.WithJWTAuth(auth.RequireRole(h.handleGetTaxRules, auth.RoleStaff), h.userStore, h.blacklistStore)).Methods(http.MethodGet)
+	router.HandleFunc("/tax/rules", auth.WithJWTAuth(auth.RequireRole(h.handleCreateTaxRule, auth.RoleAdmin), h.userStore, h.blacklistStore)).Methods(http.MethodPost)
+}
+
+func (h *Handler) handleGetTaxRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.store.GetTaxRules()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, rules)
+}
+
+// handleCreateTaxRule creates a rule, or replaces the rate of the existing
+// rule for the same country, region and category.
+func (h *Handler) handleCreateTaxRule(w http.ResponseWriter, r *http.Request) {
+	var payload models.CreateTaxRulePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return
+	}
+
+	rate, err := ParseRate(payload.Rate)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", err))
+		return
+	}
+
+	rule := models.TaxRule{
+		Country:     strings.ToUpper(payload.Country),
+		Region:      strings.ToUpper(payload.Region),
+		TaxCategory: payload.TaxCategory,
+		Rate:        FormatRate(rate),
+		Name:        payload.Name,
+	}
+	if rule.TaxCategory == "" {
+		rule.TaxCategory = DefaultCategory
+	}
+
+	id, err := h.store.CreateTaxRule(rule)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	rule.ID = id
+
+	utils.WriteJSON(w, http.StatusCreated, rule)
+}
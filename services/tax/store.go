@@ -0,0 +1,85 @@
+package tax
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mikeudacha/paybuy/models"
+)
+
+const taxRuleColumns = `id, country, region, tax_category, rate::text, name, created_at`
+
+type Store struct {
+	pool *pgxpool.Pool
+}
+
+func NewStore(pool *pgxpool.Pool) *Store {
+	return &Store{pool: pool}
+}
+
+func (s *Store) CreateTaxRule(rule models.TaxRule) (int, error) {
+	var id int
+	query := `
+		INSERT INTO tax_rules (country, region, tax_category, rate, name)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (country, region, tax_category) DO UPDATE SET rate = EXCLUDED.rate, name = EXCLUDED.name
+		RETURNING id
+	`
+	err := s.pool.QueryRow(context.Background(), query,
+		strings.ToUpper(rule.Country),
+		strings.ToUpper(rule.Region),
+		rule.TaxCategory,
+		rule.Rate,
+		rule.Name,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *Store) GetTaxRules() ([]models.TaxRule, error) {
+	query := `SELECT ` + taxRuleColumns + ` FROM tax_rules ORDER BY country, region, tax_category`
+	rows, err := s.pool.Query(context.Background(), query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanRowsIntoTaxRules(rows)
+}
+
+func (s *Store) GetTaxRulesForCountry(country string) ([]models.TaxRule, error) {
+	query := `SELECT ` + taxRuleColumns + ` FROM tax_rules WHERE country = $1 ORDER BY region, tax_category`
+	rows, err := s.pool.Query(context.Background(), query, strings.ToUpper(country))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanRowsIntoTaxRules(rows)
+}
+
+func scanRowsIntoTaxRules(rows pgx.Rows) ([]models.TaxRule, error) {
+	rules := make([]models.TaxRule, 0)
+	for rows.Next() {
+		var rule models.TaxRule
+		err := rows.Scan(
+			&rule.ID,
+			&rule.Country,
+			&rule.Region,
+			&rule.TaxCategory,
+			&rule.Rate,
+			&rule.Name,
+			&rule.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
@@ -0,0 +1,135 @@
+package user
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mikeudacha/paybuy/models"
+)
+
+type MFAStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewMFAStore(pool *pgxpool.Pool) *MFAStore {
+	return &MFAStore{pool: pool}
+}
+
+// GetTOTP returns nil when the user has not started enrolment.
+func (s *MFAStore) GetTOTP(userID int) (*models.UserTOTP, error) {
+	totp := new(models.UserTOTP)
+	query := `SELECT user_id, secret, enabled_at, last_used_step, created_at FROM user_totp WHERE user_id = $1`
+	err := s.pool.QueryRow(context.Background(), query, userID).Scan(
+		&totp.UserID,
+		&totp.Secret,
+		&totp.EnabledAt,
+		&totp.LastUsedStep,
+		&totp.CreatedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return totp, nil
+}
+
+// SetPendingTOTP starts or restarts enrolment with secret. It reports false
+// when TOTP is already enabled, leaving the active secret in place.
+func (s *MFAStore) SetPendingTOTP(userID int, secret string) (bool, error) {
+	query := `
+		INSERT INTO user_totp (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW()
+		WHERE user_totp.enabled_at IS NULL
+	`
+	tag, err := s.pool.Exec(context.Background(), query, userID, secret)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// EnableTOTP activates the pending secret, records step as used and replaces
+// the user's recovery codes. It reports false when there is no pending
+// enrolment.
+func (s *MFAStore) EnableTOTP(userID int, step int64, recoveryCodeHashes []string) (bool, error) {
+	ctx := context.Background()
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE user_totp SET enabled_at = NOW(), last_used_step = $2 WHERE user_id = $1 AND enabled_at IS NULL`
+	tag, err := tx.Exec(ctx, query, userID, step)
+	if err != nil {
+		return false, err
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return false, err
+	}
+	for _, hash := range recoveryCodeHashes {
+		query := `INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`
+		if _, err := tx.Exec(ctx, query, userID, hash); err != nil {
+			return false, err
+		}
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+// UseTOTPStep marks step as used and reports false when it is not newer than
+// the last accepted step, which stops a code from being replayed.
+func (s *MFAStore) UseTOTPStep(userID int, step int64) (bool, error) {
+	query := `
+		UPDATE user_totp SET last_used_step = $2
+		WHERE user_id = $1 AND enabled_at IS NOT NULL AND last_used_step < $2
+	`
+	tag, err := s.pool.Exec(context.Background(), query, userID, step)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// UseRecoveryCode consumes the recovery code and reports whether it was
+// valid and unused.
+func (s *MFAStore) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	query := `
+		UPDATE mfa_recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+	tag, err := s.pool.Exec(context.Background(), query, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (s *MFAStore) DisableTOTP(userID int) error {
+	ctx := context.Background()
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
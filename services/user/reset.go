@@ -0,0 +1,100 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DefaultPasswordResetTTL is how long a password reset link stays valid.
+const DefaultPasswordResetTTL = time.Hour
+
+type PasswordResetStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewPasswordResetStore(pool *pgxpool.Pool) *PasswordResetStore {
+	return &PasswordResetStore{pool: pool}
+}
+
+func (s *PasswordResetStore) CreatePasswordResetToken(userID int, tokenHash string, expiresAt time.Time) error {
+	query := `INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3)`
+	_, err := s.pool.Exec(context.Background(), query, userID, tokenHash, expiresAt)
+	return err
+}
+
+// ResetPassword consumes the token and sets the new password in one
+// transaction. Other outstanding reset tokens of the user are used up as
+// well, and every session and refresh token of the user is revoked. It reports
+// false when the token is unknown, expired or already used.
+func (s *PasswordResetStore) ResetPassword(tokenHash, hashedPassword string) (bool, error) {
+	ctx := context.Background()
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var userID int
+	query := `
+		UPDATE password_reset_tokens
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`
+	err = tx.QueryRow(ctx, query, tokenHash).Scan(&userID)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	query = `UPDATE password_reset_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return false, err
+	}
+
+	query = `UPDATE users SET password = $2, token_version = token_version + 1 WHERE id = $1`
+	if _, err := tx.Exec(ctx, query, userID, hashedPassword); err != nil {
+		return false, err
+	}
+
+	query = `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return false, err
+	}
+
+	query = `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+func (s *PasswordResetStore) CleanupExpiredTokens() error {
+	query := `DELETE FROM password_reset_tokens WHERE expires_at <= NOW()`
+
+	_, err := s.pool.Exec(context.Background(), query)
+	if err != nil {
+		return fmt.Errorf("failed to cleanup expired password reset tokens: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PasswordResetStore) CleanupExpiredTokensPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			if err := s.CleanupExpiredTokens(); err != nil {
+				fmt.Printf("Failed to cleanup expired password reset tokens: %v\n", err)
+			}
+		}
+	}()
+}
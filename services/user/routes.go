@@ -2,8 +2,11 @@ package user
 
 import (
 	"fmt"
+	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-playground/validator/v10"
@@ -11,28 +14,64 @@ import (
 	"github.com/mikeudacha/paybuy/config"
 	"github.com/mikeudacha/paybuy/models"
 	"github.com/mikeudacha/paybuy/services/auth"
+	"github.com/mikeudacha/paybuy/services/mail"
 	"github.com/mikeudacha/paybuy/utils"
 )
 
+const (
+	// verificationResendInterval throttles verification emails per user.
+	verificationResendInterval = time.Minute
+
+	// totpIssuer labels the account in authenticator apps.
+	totpIssuer = "PayBuy"
+)
+
 type Handler struct {
 	store          models.UserStore
+	resetStore     models.PasswordResetStore
+	mfaStore       models.MFAStore
+	mailer         mail.Mailer
 	blacklistStore *auth.BlacklistStore
+	refreshStore   *auth.RefreshTokenStore
 }
 
-func NewHandler(store models.UserStore, blacklistStore *auth.BlacklistStore) *Handler {
+func NewHandler(store models.UserStore, resetStore models.PasswordResetStore, mfaStore models.MFAStore, mailer mail.Mailer, blacklistStore *auth.BlacklistStore, refreshStore *auth.RefreshTokenStore) *Handler {
 	return &Handler{
 		store:          store,
+		resetStore:     resetStore,
+		mfaStore:       mfaStore,
+		mailer:         mailer,
 		blacklistStore: blacklistStore,
+		refreshStore:   refreshStore,
 	}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc("/login", h.handleLogin).Methods("POST")
+	router.HandleFunc("/login/mfa", h.handleLoginMFA).Methods(http.MethodPost)
 	router.HandleFunc("/register", h.handleRegister).Methods("POST")
 	router.HandleFunc("/refresh", h.handleRefreshToken).Methods("POST")
 	router.HandleFunc("/logout", h.handleLogout).Methods("POST")
-
+	router.HandleFunc("/password/forgot", h.handleForgotPassword).Methods(http.MethodPost)
+	router.HandleFunc("/password/reset", h.handleResetPassword).Methods(http.MethodPost)
+	router.HandleFunc("/verify-email", h.handleVerifyEmail).Methods(http.MethodGet)
+	router.HandleFunc("/verify-email/resend", auth.WithJWTAuth(h.handleResendVerification, h.store, h.blacklistStore)).Methods(http.MethodPost)
+
+	// Registered before /users/{userID} so "me" is not taken for a user ID.
+	router.HandleFunc("/users/me", auth.WithJWTAuth(h.handleGetMe, h.store, h.blacklistStore)).Methods(http.MethodGet)
+	router.HandleFunc("/users/me", auth.WithJWTAuth(h.handleUpdateMe, h.store, h.blacklistStore)).Methods(http.MethodPatch)
+	router.HandleFunc("/users/me/password", auth.WithJWTAuth(h.handleChangePassword, h.store, h.blacklistStore)).Methods(http.MethodPost)
+	router.HandleFunc("/users/me/mfa/totp", auth.WithJWTAuth(h.handleEnrolTOTP, h.store, h.blacklistStore)).Methods(http.MethodPost)
+	router.HandleFunc("/users/me/mfa/totp/confirm", auth.WithJWTAuth(h.handleConfirmTOTP, h.store, h.blacklistStore)).Methods(http.MethodPost)
+	router.HandleFunc("/users/me/mfa/totp", auth.WithJWTAuth(h.handleDisableTOTP, h.store, h.blacklistStore)).Methods(http.MethodDelete)
+	router.HandleFunc("/users/me/sessions", auth.WithJWTAuth(h.handleGetSessions, h.store, h.blacklistStore)).Methods(http.MethodGet)
+	router.HandleFunc("/users/me/sessions", auth.WithJWTAuth(h.handleRevokeAllSessions, h.store, h.blacklistStore)).Methods(http.MethodDelete)
+	router.HandleFunc("/users/me/sessions/{sessionID}", auth.WithJWTAuth(h.handleRevokeSession, h.store, h.blacklistStore)).Methods(http.MethodDelete)
 	router.HandleFunc("/users/{userID}", auth.WithJWTAuth(h.handleGetUser, h.store, h.blacklistStore)).Methods(http.MethodGet)
+
+	router.HandleFunc("/admin/users/{userID}/roles", auth.WithJWTAuth(auth.RequireRole(h.handleGetRoles, auth.RoleAdmin), h.store, h.blacklistStore)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/users/{userID}/roles", auth.WithJWTAuth(auth.RequireRole(h.handleGrantRole, auth.RoleAdmin), h.store, h.blacklistStore)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/users/{userID}/roles/{role}", auth.WithJWTAuth(auth.RequireRole(h.handleRevokeRole, auth.RoleAdmin), h.store, h.blacklistStore)).Methods(http.MethodDelete)
 }
 
 func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
@@ -59,13 +98,113 @@ func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tokenPair, err := auth.CreateTokenPair(u.ID)
+	totp, err := h.mfaStore.GetTOTP(u.ID)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
+	if totp != nil && totp.EnabledAt != nil {
+		cfg := config.LoadConfig()
+		mfaToken, err := auth.CreateJWT([]byte(cfg.JWTSecret), u.ID, "mfa", nil)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusOK, models.LoginResponse{
+			ExpiresIn:   int64(auth.MFATokenTTL.Seconds()),
+			Message:     "Two-factor authentication required. Send the MFA token and a code to /login/mfa.",
+			MFARequired: true,
+			MFAToken:    mfaToken,
+		})
+		return
+	}
+
+	h.completeLogin(w, r, u)
+}
+
+// handleLoginMFA finishes a login started by handleLogin. MFA tokens are
+// single use: a wrong code means starting over with the password, which keeps
+// guessing as slow as password attempts.
+func (h *Handler) handleLoginMFA(w http.ResponseWriter, r *http.Request) {
+	var payload models.LoginMFAPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return
+	}
+
+	token, err := auth.ValidateJWT(payload.MFAToken, "mfa")
+	if err != nil || !token.Valid {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid or expired MFA token"))
+		return
+	}
+
+	claims := token.Claims.(*auth.JWTClaims)
+	userID, err := strconv.Atoi(claims.UserID)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid or expired MFA token"))
+		return
+	}
+
+	// The MFA token is spent before the code is checked, so each token gets
+	// exactly one guess even when requests race.
+	consumed, err := h.blacklistStore.ConsumeToken(payload.MFAToken, userID, claims.ExpiresAt.Time)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !consumed {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid or expired MFA token"))
+		return
+	}
+
+	u, err := h.store.GetUserByID(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid or expired MFA token"))
+		return
+	}
+
+	ok, err := h.verifySecondFactor(userID, payload.Code)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid authentication code, please log in again"))
+		return
+	}
+
+	h.completeLogin(w, r, u)
+}
+
+// completeLogin issues the token pair once every login factor has passed.
+func (h *Handler) completeLogin(w http.ResponseWriter, r *http.Request, u *models.User) {
 	cfg := config.LoadConfig()
+
+	if err := h.grantBootstrapAdmin(u, cfg.BootstrapAdminEmail); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	roles, err := h.store.GetUserRoles(u.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	tokenPair, err := h.refreshStore.Issue(u.ID, roles, sessionClient(r))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
 	refreshExpiration, _ := strconv.Atoi(cfg.JWTRefreshExpirationInSeconds)
 	utils.SetHttpOnlyCookie(w, "refresh_token", tokenPair.RefreshToken, refreshExpiration)
 
@@ -78,6 +217,164 @@ func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
 	utils.WriteJSON(w, http.StatusOK, response)
 }
 
+// grantBootstrapAdmin makes u an admin on the first login of bootstrapEmail
+// as long as no admin exists yet; later admins are granted via /admin. The
+// address must be verified, otherwise whoever registers it first would get
+// the role without owning the mailbox.
+func (h *Handler) grantBootstrapAdmin(u *models.User, bootstrapEmail string) error {
+	if bootstrapEmail == "" || u.EmailVerifiedAt == nil || !strings.EqualFold(u.Email, bootstrapEmail) {
+		return nil
+	}
+
+	_, err := h.store.GrantBootstrapAdmin(u.ID)
+	return err
+}
+
+// verifySecondFactor accepts a current TOTP code or an unused recovery code.
+func (h *Handler) verifySecondFactor(userID int, code string) (bool, error) {
+	totp, err := h.mfaStore.GetTOTP(userID)
+	if err != nil || totp == nil || totp.EnabledAt == nil {
+		return false, err
+	}
+
+	if step, ok := auth.ValidateTOTP(totp.Secret, code, time.Now()); ok {
+		return h.mfaStore.UseTOTPStep(userID, step)
+	}
+
+	return h.mfaStore.UseRecoveryCode(userID, auth.HashRecoveryCode(code))
+}
+
+func (h *Handler) handleEnrolTOTP(w http.ResponseWriter, r *http.Request) {
+	u, err := h.store.GetUserByID(auth.GetUserIDFromContext(r.Context()))
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	ok, err := h.mfaStore.SetPendingTOTP(u.ID, secret)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("two-factor authentication is already enabled"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, models.TOTPEnrolmentResponse{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(totpIssuer, u.Email, secret),
+	})
+}
+
+// handleConfirmTOTP enables TOTP once the user proves their app produces
+// valid codes and returns the recovery codes, which are not shown again.
+func (h *Handler) handleConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	var payload models.TOTPCodePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return
+	}
+
+	userID := auth.GetUserIDFromContext(r.Context())
+	totp, err := h.mfaStore.GetTOTP(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if totp == nil {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("start two-factor enrolment first"))
+		return
+	}
+	if totp.EnabledAt != nil {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("two-factor authentication is already enabled"))
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(totp.Secret, payload.Code, time.Now())
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid authentication code"))
+		return
+	}
+
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	enabled, err := h.mfaStore.EnableTOTP(userID, step, hashes)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !enabled {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("two-factor authentication is already enabled"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"message":        "Two-factor authentication enabled. Store the recovery codes somewhere safe.",
+		"recovery_codes": codes,
+	})
+}
+
+func (h *Handler) handleDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	var payload models.DisableTOTPPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return
+	}
+
+	u, err := h.store.GetUserByID(auth.GetUserIDFromContext(r.Context()))
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if !auth.ComparePasswords(u.Password, []byte(payload.Password)) {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("password is incorrect"))
+		return
+	}
+
+	ok, err := h.verifySecondFactor(u.ID, payload.Code)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid authentication code"))
+		return
+	}
+
+	if err := h.mfaStore.DisableTOTP(u.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "Two-factor authentication disabled.",
+	})
+}
+
 func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
 	var user models.RegisterUserPayload
 	if err := utils.ParseJSON(r, &user); err != nil {
@@ -113,6 +410,12 @@ func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
+
+	if u, err := h.store.GetUserByEmail(user.Email); err != nil {
+		log.Printf("email verification for %s: %v", user.Email, err)
+	} else if _, err := h.sendVerificationEmail(u); err != nil {
+		log.Printf("email verification for user %d: %v", u.ID, err)
+	}
 	utils.WriteJSON(w, http.StatusCreated, nil)
 }
 
@@ -123,8 +426,9 @@ func (h *Handler) handleRefreshToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tokenPair, err := auth.RefreshAccessToken(refreshToken, h.blacklistStore)
+	tokenPair, err := h.refreshStore.Refresh(refreshToken, h.store, sessionClient(r))
 	if err != nil {
+		utils.DeleteCookie(w, "refresh_token")
 		utils.WriteError(w, http.StatusUnauthorized, err)
 		return
 	}
@@ -149,49 +453,397 @@ func (h *Handler) handleLogout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := auth.ValidateJWT(refreshToken, "refresh")
-	if err != nil {
+	if _, err := auth.ValidateJWT(refreshToken, "refresh"); err != nil {
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid refresh token"))
 		return
 	}
 
-	claims := token.Claims.(*auth.JWTClaims)
-	userID, err := strconv.Atoi(claims.UserID)
+	if err := h.refreshStore.RevokeFamily(refreshToken); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to logout"))
+		return
+	}
+
+	utils.DeleteCookie(w, "refresh_token")
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "Successfully logged out. Refresh token removed from cookies and revoked.",
+	})
+}
+
+// handleForgotPassword mails a reset link when the email is registered. The
+// response is the same either way, and the mail is sent in the background,
+// so callers cannot probe which emails have accounts.
+func (h *Handler) handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var payload models.ForgotPasswordPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return
+	}
+
+	if u, err := h.store.GetUserByEmail(payload.Email); err == nil {
+		if err := h.sendPasswordReset(u); err != nil {
+			log.Printf("password reset for user %d: %v", u.ID, err)
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusAccepted, map[string]string{
+		"message": "If an account exists for this email, a password reset link has been sent.",
+	})
+}
+
+// sendPasswordReset mails u a link to the frontend page at PASSWORD_RESET_URL,
+// which collects the new password and posts it with the token to
+// /password/reset.
+func (h *Handler) sendPasswordReset(u *models.User) error {
+	cfg := config.LoadConfig()
+	link, err := url.Parse(cfg.PasswordResetURL)
+	if err != nil || cfg.PasswordResetURL == "" {
+		return fmt.Errorf("PASSWORD_RESET_URL is not a valid URL")
+	}
+
+	token, tokenHash, err := auth.NewOpaqueToken()
 	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid user ID in token"))
+		return err
+	}
+
+	expiresAt := time.Now().Add(DefaultPasswordResetTTL)
+	if err := h.resetStore.CreatePasswordResetToken(u.ID, tokenHash, expiresAt); err != nil {
+		return err
+	}
+
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	msg := mail.Message{
+		To:      u.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nUse the link below to choose a new password. It expires in %d minutes and can be used once.\n\n%s\n\nIf you did not ask for a reset you can ignore this email.\n",
+			u.FirstName, int(DefaultPasswordResetTTL.Minutes()), link,
+		),
+	}
+
+	go func() {
+		if err := h.mailer.Send(msg); err != nil {
+			log.Printf("sending password reset mail to user %d: %v", u.ID, err)
+		}
+	}()
+
+	return nil
+}
+
+func (h *Handler) handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var payload models.ResetPasswordPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	expiresAt := time.Now().Add(24 * time.Hour)
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return
+	}
 
-	err = h.blacklistStore.AddToBlacklist(refreshToken, userID, expiresAt)
+	hashedPassword, err := auth.HashedPassword(payload.NewPassword)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to logout"))
+		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	utils.DeleteCookie(w, "refresh_token")
+	ok, err := h.resetStore.ResetPassword(auth.HashOpaqueToken(payload.Token), hashedPassword)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid or expired reset token"))
+		return
+	}
 
 	utils.WriteJSON(w, http.StatusOK, map[string]string{
-		"message": "Successfully logged out. Refresh token removed from cookies and added to blacklist.",
+		"message": "Password has been reset. Please log in with your new password.",
 	})
 }
 
-func (h *Handler) handleGetUser(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	str, ok := vars["userID"]
+func (h *Handler) handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	userID, email, err := auth.ParseEmailVerificationToken(r.URL.Query().Get("token"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ok, err := h.store.MarkEmailVerified(userID, email)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
 	if !ok {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing user ID"))
+		utils.WriteError(w, http.StatusBadRequest, auth.ErrInvalidVerificationToken)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "Email address verified.",
+	})
+}
+
+func (h *Handler) handleResendVerification(w http.ResponseWriter, r *http.Request) {
+	u, err := h.store.GetUserByID(auth.GetUserIDFromContext(r.Context()))
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if u.EmailVerifiedAt != nil {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("email address is already verified"))
+		return
+	}
+
+	sent, err := h.sendVerificationEmail(u)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !sent {
+		w.Header().Set("Retry-After", strconv.Itoa(int(verificationResendInterval.Seconds())))
+		utils.WriteError(w, http.StatusTooManyRequests, fmt.Errorf("a verification email was sent recently, please try again later"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusAccepted, map[string]string{
+		"message": "Verification email sent.",
+	})
+}
+
+// sendVerificationEmail mails a verification link unless the user is already
+// verified or was sent one within verificationResendInterval, and reports
+// whether it did.
+func (h *Handler) sendVerificationEmail(u *models.User) (bool, error) {
+	claimed, err := h.store.ClaimVerificationEmail(u.ID, verificationResendInterval)
+	if err != nil || !claimed {
+		return false, err
+	}
+
+	token, err := auth.CreateEmailVerificationToken(u.ID, u.Email)
+	if err != nil {
+		return false, err
+	}
+
+	cfg := config.LoadConfig()
+	msg := mail.Message{
+		To:      u.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nPlease confirm your email address by opening the link below. It expires in %d hours.\n\n%s/verify-email?token=%s\n",
+			u.FirstName, int(auth.EmailVerificationTTL.Hours()), cfg.PublicHost, url.QueryEscape(token),
+		),
+	}
+
+	go func() {
+		if err := h.mailer.Send(msg); err != nil {
+			log.Printf("sending verification mail to user %d: %v", u.ID, err)
+		}
+	}()
+
+	return true, nil
+}
+
+func (h *Handler) handleGetMe(w http.ResponseWriter, r *http.Request) {
+	h.writeProfile(w, auth.GetUserIDFromContext(r.Context()))
+}
+
+func (h *Handler) handleUpdateMe(w http.ResponseWriter, r *http.Request) {
+	var payload models.UpdateProfilePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return
+	}
+
+	userID := auth.GetUserIDFromContext(r.Context())
+	user, err := h.store.GetUserByID(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if payload.FirstName != nil {
+		user.FirstName = *payload.FirstName
+	}
+	if payload.LastName != nil {
+		user.LastName = *payload.LastName
+	}
+
+	if err := h.store.UpdateUser(*user); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.writeProfile(w, userID)
+}
+
+// handleChangePassword revokes every refresh token of the user and issues a
+// new token pair so only the session that changed the password stays
+// signed in.
+func (h *Handler) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	var payload models.ChangePasswordPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return
+	}
+
+	userID := auth.GetUserIDFromContext(r.Context())
+	user, err := h.store.GetUserByID(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if !auth.ComparePasswords(user.Password, []byte(payload.CurrentPassword)) {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("current password is incorrect"))
+		return
+	}
+
+	hashedPassword, err := auth.HashedPassword(payload.NewPassword)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.store.UpdatePassword(userID, hashedPassword); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.refreshStore.RevokeUser(userID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	tokenPair, err := h.refreshStore.Issue(userID, auth.GetRolesFromContext(r.Context()), sessionClient(r))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	cfg := config.LoadConfig()
+	refreshExpiration, _ := strconv.Atoi(cfg.JWTRefreshExpirationInSeconds)
+	utils.SetHttpOnlyCookie(w, "refresh_token", tokenPair.RefreshToken, refreshExpiration)
+
+	response := models.LoginResponse{
+		AccessToken: tokenPair.AccessToken,
+		ExpiresIn:   tokenPair.ExpiresIn,
+		Message:     "Password changed. Refresh tokens of other sessions have been revoked.",
+	}
+
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+func (h *Handler) handleGetSessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	sessions, err := h.refreshStore.GetSessions(auth.GetUserIDFromContext(ctx))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	current := auth.GetSessionFamilyFromContext(ctx)
+	for i := range sessions {
+		sessions[i].Current = current != "" && sessions[i].FamilyID == current
+	}
+
+	utils.WriteJSON(w, http.StatusOK, sessions)
+}
+
+func (h *Handler) handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := strconv.Atoi(mux.Vars(r)["sessionID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid session ID"))
+		return
+	}
+
+	revoked, err := h.refreshStore.RevokeSession(auth.GetUserIDFromContext(r.Context()), sessionID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !revoked {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("session not found"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "Session revoked.",
+	})
+}
+
+// handleRevokeAllSessions logs the user out everywhere, including the session
+// making the request.
+func (h *Handler) handleRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	if err := h.refreshStore.RevokeUser(auth.GetUserIDFromContext(r.Context())); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	userID, err := strconv.Atoi(str)
+	utils.DeleteCookie(w, "refresh_token")
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "Logged out of all sessions.",
+	})
+}
+
+func sessionClient(r *http.Request) models.SessionClient {
+	return models.SessionClient{
+		UserAgent: r.UserAgent(),
+		IP:        utils.ClientIP(r),
+	}
+}
+
+// handleGetUser returns the profile of userID to that user or an admin.
+func (h *Handler) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
 	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid user ID"))
+		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
 
+	ctx := r.Context()
+	if userID != auth.GetUserIDFromContext(ctx) && !auth.HasRole(auth.GetRolesFromContext(ctx), auth.RoleAdmin) {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("permission denied"))
+		return
+	}
+
+	h.writeProfile(w, userID)
+}
+
+func (h *Handler) writeProfile(w http.ResponseWriter, userID int) {
 	user, err := h.store.GetUserByID(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	user.Roles, err = h.store.GetUserRoles(userID)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -199,3 +851,92 @@ func (h *Handler) handleGetUser(w http.ResponseWriter, r *http.Request) {
 
 	utils.WriteJSON(w, http.StatusOK, user)
 }
+
+func (h *Handler) handleGetRoles(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	roles, err := h.store.GetUserRoles(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{"userID": userID, "roles": roles})
+}
+
+func (h *Handler) handleGrantRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var payload models.RolePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validator.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return
+	}
+
+	if _, err := h.store.GetUserByID(userID); err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	grantedBy := auth.GetUserIDFromContext(r.Context())
+	if err := h.store.GrantRole(userID, payload.Role, &grantedBy); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.handleGetRoles(w, r)
+}
+
+func (h *Handler) handleRevokeRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	role := mux.Vars(r)["role"]
+	if !auth.IsValidRole(role) {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("unknown role %q", role))
+		return
+	}
+
+	// Stops the last admin from locking everyone out by accident.
+	if role == auth.RoleAdmin && userID == auth.GetUserIDFromContext(r.Context()) {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("admins cannot revoke their own admin role"))
+		return
+	}
+
+	revoked, err := h.store.RevokeRole(userID, role)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !revoked {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("user %d does not have role %s", userID, role))
+		return
+	}
+
+	h.handleGetRoles(w, r)
+}
+
+func (h *Handler) getUserID(r *http.Request) (int, error) {
+	userID, err := strconv.Atoi(mux.Vars(r)["userID"])
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID")
+	}
+	return userID, nil
+}
@@ -0,0 +1,65 @@
+package user
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mikeudacha/paybuy/models"
+)
+
+// bootstrapStore records GrantBootstrapAdmin calls. Other UserStore methods
+// are not used by the code under test.
+type bootstrapStore struct {
+	models.UserStore
+	granted []int
+}
+
+func (s *bootstrapStore) GrantBootstrapAdmin(userID int) (bool, error) {
+	s.granted = append(s.granted, userID)
+	return true, nil
+}
+
+func TestGrantBootstrapAdmin(t *testing.T) {
+	verified := time.Now()
+
+	tests := []struct {
+		name        string
+		user        models.User
+		email       string
+		wantGranted bool
+	}{
+		{
+			name:        "verified bootstrap account",
+			user:        models.User{ID: 1, Email: "Admin@example.com", EmailVerifiedAt: &verified},
+			email:       "admin@example.com",
+			wantGranted: true,
+		},
+		{
+			name:  "unverified bootstrap account",
+			user:  models.User{ID: 2, Email: "admin@example.com"},
+			email: "admin@example.com",
+		},
+		{
+			name:  "other account",
+			user:  models.User{ID: 3, Email: "someone@example.com", EmailVerifiedAt: &verified},
+			email: "admin@example.com",
+		},
+		{
+			name: "bootstrap disabled",
+			user: models.User{ID: 4, Email: "admin@example.com", EmailVerifiedAt: &verified},
+		},
+	}
+
+	for _, tt := range tests {
+		store := &bootstrapStore{}
+		h := NewHandler(store, nil, nil, nil, nil, nil)
+
+		if err := h.grantBootstrapAdmin(&tt.user, tt.email); err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if granted := len(store.granted) > 0; granted != tt.wantGranted {
+			t.Errorf("%s: granted admin = %v, want %v", tt.name, granted, tt.wantGranted)
+		}
+	}
+}
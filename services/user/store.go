@@ -3,12 +3,15 @@ package user
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/mikeudacha/paybuy/models"
 )
 
+const userColumns = `id, first_name, last_name, email, password, email_verified_at, token_version, created_at`
+
 type Store struct {
 	pool *pgxpool.Pool
 }
@@ -18,7 +21,7 @@ func NewStore(pool *pgxpool.Pool) *Store {
 }
 
 func (s *Store) GetUserByEmail(email string) (*models.User, error) {
-	query := `SELECT id, first_name, last_name, email, password, created_at FROM users WHERE email = $1`
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = $1`
 	rows, err := s.pool.Query(context.Background(), query, email)
 	if err != nil {
 		return nil, err
@@ -38,7 +41,7 @@ func (s *Store) GetUserByEmail(email string) (*models.User, error) {
 }
 
 func (s *Store) GetUserByID(id int) (*models.User, error) {
-	query := `SELECT email FROM users WHERE id = $1`
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
 	rows, err := s.pool.Query(context.Background(), query, id)
 	if err != nil {
 		return nil, err
@@ -57,13 +60,129 @@ func (s *Store) GetUserByID(id int) (*models.User, error) {
 	return user, nil
 }
 
+// CreateUser inserts the user together with the customer role every account
+// starts with.
 func (s *Store) CreateUser(user models.User) error {
-	query := `INSERT INTO users (first_name, last_name, email, password) VALUES($1, $2, $3, $4)`
-	_, err := s.pool.Exec(context.Background(), query, user.FirstName, user.LastName, user.Email, user.Password)
+	ctx := context.Background()
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var id int
+	query := `INSERT INTO users (first_name, last_name, email, password) VALUES($1, $2, $3, $4) RETURNING id`
+	err = tx.QueryRow(ctx, query, user.FirstName, user.LastName, user.Email, user.Password).Scan(&id)
 	if err != nil {
 		return err
 	}
-	return nil
+
+	if _, err := tx.Exec(ctx, `INSERT INTO user_roles (user_id, role) VALUES ($1, 'customer')`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *Store) UpdateUser(user models.User) error {
+	query := `UPDATE users SET first_name = $2, last_name = $3 WHERE id = $1`
+	_, err := s.pool.Exec(context.Background(), query, user.ID, user.FirstName, user.LastName)
+	return err
+}
+
+// UpdatePassword stores the new password hash and bumps the user's token
+// version, so refresh tokens issued before the change stop working while
+// tokens issued right after it do not.
+func (s *Store) UpdatePassword(userID int, hashedPassword string) error {
+	query := `UPDATE users SET password = $2, token_version = token_version + 1 WHERE id = $1`
+	_, err := s.pool.Exec(context.Background(), query, userID, hashedPassword)
+	return err
+}
+
+// MarkEmailVerified verifies the user's email if it is still email and
+// reports whether it matched. Verifying twice keeps the first timestamp.
+func (s *Store) MarkEmailVerified(userID int, email string) (bool, error) {
+	query := `UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()) WHERE id = $1 AND email = $2`
+	tag, err := s.pool.Exec(context.Background(), query, userID, email)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// ClaimVerificationEmail records that a verification email is being sent and
+// reports false when the user is already verified or one was sent less than
+// interval ago.
+func (s *Store) ClaimVerificationEmail(userID int, interval time.Duration) (bool, error) {
+	query := `
+		UPDATE users SET verification_sent_at = NOW()
+		WHERE id = $1
+			AND email_verified_at IS NULL
+			AND (verification_sent_at IS NULL OR verification_sent_at <= NOW() - $2 * INTERVAL '1 second')
+	`
+	tag, err := s.pool.Exec(context.Background(), query, userID, interval.Seconds())
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (s *Store) GetUserRoles(userID int) ([]string, error) {
+	query := `SELECT role FROM user_roles WHERE user_id = $1 ORDER BY role`
+	rows, err := s.pool.Query(context.Background(), query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := make([]string, 0)
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// GrantRole is a no-op when the user already holds role.
+func (s *Store) GrantRole(userID int, role string, grantedBy *int) error {
+	query := `
+		INSERT INTO user_roles (user_id, role, granted_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, role) DO NOTHING
+	`
+	_, err := s.pool.Exec(context.Background(), query, userID, role, grantedBy)
+	return err
+}
+
+// RevokeRole reports whether the user held role.
+func (s *Store) RevokeRole(userID int, role string) (bool, error) {
+	query := `DELETE FROM user_roles WHERE user_id = $1 AND role = $2`
+	tag, err := s.pool.Exec(context.Background(), query, userID, role)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GrantBootstrapAdmin makes the user an admin if nobody holds the admin role
+// yet and reports whether it did.
+func (s *Store) GrantBootstrapAdmin(userID int) (bool, error) {
+	query := `
+		INSERT INTO user_roles (user_id, role)
+		SELECT $1, 'admin'
+		WHERE NOT EXISTS (SELECT 1 FROM user_roles WHERE role = 'admin')
+		ON CONFLICT (user_id, role) DO NOTHING
+	`
+	tag, err := s.pool.Exec(context.Background(), query, userID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
 }
 
 func scanRowsIntoUser(rows pgx.Rows) (*models.User, error) {
@@ -75,6 +194,8 @@ func scanRowsIntoUser(rows pgx.Rows) (*models.User, error) {
 		&user.LastName,
 		&user.Email,
 		&user.Password,
+		&user.EmailVerifiedAt,
+		&user.TokenVersion,
 		&user.CreatedAt,
 	)
 	if err != nil {
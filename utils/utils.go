@@ -3,7 +3,9 @@ package utils
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/mikeudacha/paybuy/config"
@@ -47,6 +49,22 @@ func GetTokenFromRequest(r *http.Request) string {
 	return ""
 }
 
+// ClientIP returns the first address in X-Forwarded-For when a proxy set it
+// and the connection's remote address otherwise. The header can be forged
+// by clients, so the result is only fit for display.
+func ClientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		ip, _, _ := strings.Cut(forwarded, ",")
+		return strings.TrimSpace(ip)
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 func SetHttpOnlyCookie(w http.ResponseWriter, name, value string, maxAge int) {
 	cfg := config.LoadConfig()
 
@@ -94,3 +112,40 @@ func DeleteCookie(w http.ResponseWriter, name string) {
 		Domain:   cfg.CookieDomain,
 	})
 }
+
+// MergePatch applies a JSON merge patch (RFC 7386) to the JSON document
+// target: objects are merged recursively, null removes a member and any
+// other value replaces it.
+func MergePatch(target, patch []byte) ([]byte, error) {
+	var t, p any
+	if err := json.Unmarshal(target, &t); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, fmt.Errorf("invalid merge patch: %w", err)
+	}
+
+	return json.Marshal(mergePatch(t, p))
+}
+
+func mergePatch(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = make(map[string]any)
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergePatch(targetObject[key], value)
+	}
+
+	return targetObject
+}